@@ -0,0 +1,225 @@
+package cache
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// getBytes 获取key对应的字节切片，key不存在或者已经过期时返回false，外部加锁
+func (c *Cache) getBytes(k string) ([]byte, bool, error) {
+	item, ok := c.lookup(k)
+	if !ok {
+		return nil, false, nil
+	}
+	b, ok := item.Object.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("the value for %s is not a byte slice", k)
+	}
+	return b, true, nil
+}
+
+// SetBit 设置位图中offset位置的值，返回原来的值，位图长度不够时自动补零，
+// key不存在时使用默认过期时间新建，offset从每个字节的最高位开始计算
+func (c *Cache) SetBit(k string, offset int64, value int) (int, error) {
+	if offset < 0 || offset >= maxBitOffset {
+		return 0, fmt.Errorf("bit offset is out of range")
+	}
+	if value != 0 && value != 1 {
+		return 0, fmt.Errorf("bit value must be 0 or 1")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok, err := c.getBytes(k)
+	if err != nil {
+		return 0, err
+	}
+
+	// Get和Snapshot返回的位图可能还在被读取，交出去之后第一次写入时复制一份，
+	// 之后没有再交出去就原地修改，长度不够时补零
+	idx := int(offset >> 3)
+	switch {
+	case !c.owns(k):
+		n := len(b)
+		if idx >= n {
+			n = idx + 1
+		}
+		cp := make([]byte, n)
+		copy(cp, b)
+		b = cp
+	case idx >= len(b):
+		b = append(b, make([]byte, idx+1-len(b))...)
+	}
+	mask := byte(1) << (7 - uint(offset&7))
+	old := 0
+	if b[idx]&mask != 0 {
+		old = 1
+	}
+	if value == 1 {
+		b[idx] |= mask
+	} else {
+		b[idx] &^= mask
+	}
+
+	if !ok {
+		c.add(k, b, DefaultExpiration)
+	} else {
+		c.update(k, b)
+	}
+	c.own(k)
+	return old, nil
+}
+
+// GetBit 返回位图中offset位置的值，超出长度的位置都是0
+func (c *Cache) GetBit(k string, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, fmt.Errorf("bit offset is out of range")
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	b, _, err := c.getBytes(k)
+	if err != nil {
+		return 0, err
+	}
+	idx := offset >> 3
+	if idx >= int64(len(b)) {
+		return 0, nil
+	}
+	return int(b[idx]>>(7-uint(offset&7))) & 1, nil
+}
+
+// BitCount 统计位图中1的数量
+func (c *Cache) BitCount(k string) (int, error) {
+	return c.BitCountRange(k, 0, -1)
+}
+
+// BitCountRange 统计位图中字节下标在[start, end]之间的1的数量，下标为负数时从尾部开始计算
+func (c *Cache) BitCountRange(k string, start, end int) (int, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	b, _, err := c.getBytes(k)
+	if err != nil {
+		return 0, err
+	}
+	from, to, ok := listRange(start, end, len(b))
+	if !ok {
+		return 0, nil
+	}
+	n := 0
+	for _, x := range b[from:to] {
+		n += bits.OnesCount8(x)
+	}
+	return n, nil
+}
+
+// BitPos 返回位图中第一个值为bit的位置，找不到1时返回-1，
+// 找不到0时返回位图长度之后的第一个位置，因为超出长度的位置都是0
+func (c *Cache) BitPos(k string, bit int) (int64, error) {
+	return c.bitPos(k, bit, 0, -1, false)
+}
+
+// BitPosRange 在字节下标[start, end]之间查找第一个值为bit的位置，找不到时返回-1
+func (c *Cache) BitPosRange(k string, bit, start, end int) (int64, error) {
+	return c.bitPos(k, bit, start, end, true)
+}
+
+func (c *Cache) bitPos(k string, bit, start, end int, hasEnd bool) (int64, error) {
+	if bit != 0 && bit != 1 {
+		return 0, fmt.Errorf("bit value must be 0 or 1")
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	b, _, err := c.getBytes(k)
+	if err != nil {
+		return 0, err
+	}
+	from, to, ok := listRange(start, end, len(b))
+	if !ok {
+		if bit == 0 && !hasEnd && len(b) == 0 {
+			return 0, nil
+		}
+		return -1, nil
+	}
+
+	for i := from; i < to; i++ {
+		x := b[i]
+		if bit == 0 {
+			x = ^x
+		}
+		if x != 0 {
+			return int64(i)*8 + int64(bits.LeadingZeros8(x)), nil
+		}
+	}
+	if bit == 0 && !hasEnd {
+		return int64(to) * 8, nil
+	}
+	return -1, nil
+}
+
+// BitOp 对多个位图做按位运算，结果保存到dest，返回结果的字节长度，
+// 长度不同的位图按照最长的补零，结果为空时删除dest
+func (c *Cache) BitOp(op, dest string, keys ...string) (int, error) {
+	if len(keys) == 0 {
+		return 0, fmt.Errorf("at least one key is required")
+	}
+	if op == BITNOT && len(keys) != 1 {
+		return 0, fmt.Errorf("bitop not must be called with a single key")
+	}
+	if op != BITAND && op != BITOR && op != BITXOR && op != BITNOT {
+		return 0, fmt.Errorf("unknown bitop %s", op)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	srcs := make([][]byte, len(keys))
+	maxLen := 0
+	for i, k := range keys {
+		b, _, err := c.getBytes(k)
+		if err != nil {
+			return 0, err
+		}
+		srcs[i] = b
+		if len(b) > maxLen {
+			maxLen = len(b)
+		}
+	}
+
+	res := make([]byte, maxLen)
+	for i := range res {
+		at := func(j int) byte {
+			if i < len(srcs[j]) {
+				return srcs[j][i]
+			}
+			return 0
+		}
+		x := at(0)
+		for j := 1; j < len(srcs); j++ {
+			switch op {
+			case BITAND:
+				x &= at(j)
+			case BITOR:
+				x |= at(j)
+			case BITXOR:
+				x ^= at(j)
+			}
+		}
+		if op == BITNOT {
+			x = ^x
+		}
+		res[i] = x
+	}
+
+	if len(res) > 0 {
+		c.put(dest, res, DefaultExpiration)
+	} else if _, ok := c.lookup(dest); ok {
+		c.manualDelete(dest)
+	}
+	return len(res), nil
+}
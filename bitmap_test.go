@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBitmap(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	// 前12位是1，写入第23位时补齐到3个字节
+	for i := int64(0); i < 12; i++ {
+		old, err := c.SetBit("b", i, 1)
+		require.NoError(t, err)
+		require.Equal(t, 0, old)
+	}
+	old, err := c.SetBit("b", 23, 1)
+	require.NoError(t, err)
+	require.Equal(t, 0, old)
+	v, _ := c.Get("b")
+	require.Equal(t, []byte{0xff, 0xf0, 0x01}, v)
+	old, err = c.SetBit("b", 23, 1)
+	require.NoError(t, err)
+	require.Equal(t, 1, old)
+	_, err = c.SetBit("b", -1, 1)
+	require.Error(t, err)
+	_, err = c.SetBit("b", 0, 2)
+	require.Error(t, err)
+
+	bit, err := c.GetBit("b", 11)
+	require.NoError(t, err)
+	require.Equal(t, 1, bit)
+	bit, err = c.GetBit("b", 1000)
+	require.NoError(t, err)
+	require.Equal(t, 0, bit)
+
+	n, err := c.BitCount("b")
+	require.NoError(t, err)
+	require.Equal(t, 13, n)
+	n, err = c.BitCountRange("b", -2, -1)
+	require.NoError(t, err)
+	require.Equal(t, 5, n)
+	n, err = c.BitCountRange("b", 5, 10)
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	pos, err := c.BitPos("b", 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(12), pos)
+	pos, err = c.BitPosRange("b", 1, -1, -1)
+	require.NoError(t, err)
+	require.Equal(t, int64(23), pos)
+	pos, err = c.BitPosRange("b", 0, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(-1), pos)
+
+	// 全是1时找0：没有指定范围返回长度之后的位置，指定了范围返回-1
+	c.Set("ones", []byte{0xff}, DefaultExpiration)
+	pos, err = c.BitPos("ones", 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(8), pos)
+	pos, err = c.BitPosRange("ones", 0, 0, -1)
+	require.NoError(t, err)
+	require.Equal(t, int64(-1), pos)
+	pos, err = c.BitPos("missing", 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), pos)
+	pos, err = c.BitPos("missing", 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(-1), pos)
+
+	// 长度不同的位图按最长的补零
+	c.Set("x", []byte{0xff, 0x0f}, DefaultExpiration)
+	c.Set("y", []byte{0xf0}, DefaultExpiration)
+	for op, want := range map[string][]byte{
+		BITAND: {0xf0, 0x00},
+		BITOR:  {0xff, 0x0f},
+		BITXOR: {0x0f, 0x0f},
+	} {
+		n, err := c.BitOp(op, "dest", "x", "y")
+		require.NoError(t, err)
+		require.Equal(t, 2, n)
+		v, _ := c.Get("dest")
+		require.Equal(t, want, v, op)
+	}
+	n, err = c.BitOp(BITNOT, "dest", "x")
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	v, _ = c.Get("dest")
+	require.Equal(t, []byte{0x00, 0xf0}, v)
+	_, err = c.BitOp(BITNOT, "dest", "x", "y")
+	require.Error(t, err)
+	_, err = c.BitOp("nand", "dest", "x")
+	require.Error(t, err)
+
+	// 结果为空时删除dest
+	n, err = c.BitOp(BITOR, "dest", "missing")
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+	require.False(t, c.IsExistedKey("dest"))
+
+	c.Set("str", "v", DefaultExpiration)
+	_, err = c.SetBit("str", 0, 1)
+	require.Error(t, err)
+}
+
+func TestBitmapCopyOnWrite(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	_, err := c.SetBit("b", 0, 1)
+	require.NoError(t, err)
+	v, _ := c.Get("b")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := int64(1); i < 8; i++ {
+			_, _ = c.SetBit("b", i, 1)
+		}
+	}()
+	held := v.([]byte)
+	for i := 0; i < 100; i++ {
+		_ = held[0]
+	}
+	<-done
+	require.Equal(t, []byte{0x80}, held)
+	v, _ = c.Get("b")
+	require.Equal(t, []byte{0xff}, v)
+
+	// 没有交出去的位图原地修改，不会每次写入都复制
+	_, err = c.SetBit("b", 80, 1)
+	require.NoError(t, err)
+	first := &c.items["b"].Object.([]byte)[0]
+	_, err = c.SetBit("b", 9, 1)
+	require.NoError(t, err)
+	require.Same(t, first, &c.items["b"].Object.([]byte)[0])
+
+	// 快照之后的写入会复制一份，快照不变
+	s := c.Snapshot()
+	_, err = c.SetBit("b", 10, 1)
+	require.NoError(t, err)
+	require.NotSame(t, first, &c.items["b"].Object.([]byte)[0])
+	v, _ = s.Get("b")
+	require.Equal(t, byte(0x40), v.([]byte)[1])
+
+	// Set写入的切片属于调用方，不能原地修改
+	own := []byte{0}
+	c.Set("user", own, DefaultExpiration)
+	_, err = c.SetBit("user", 0, 1)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0}, own)
+}
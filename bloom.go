@@ -0,0 +1,255 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"math"
+)
+
+const (
+	defaultBloomErrorRate = 0.01 // 默认的误判率
+	defaultBloomCapacity  = 100  // 默认的初始容量
+	defaultBloomExpansion = 2    // 默认每次扩容的倍数
+	bloomTightening       = 0.5  // 每扩容一层，新一层的误判率乘以这个系数，保证总的误判率收敛
+)
+
+// bloomLayer 可扩容布隆过滤器中的一层
+type bloomLayer struct {
+	Bits     []uint64 // 位数组
+	M        uint64   // 位数
+	K        uint64   // 哈希函数的数量
+	Capacity uint64   // 这一层能容纳的元素数量
+	Count    uint64   // 这一层已经加入的元素数量
+}
+
+func newBloomLayer(capacity uint64, errorRate float64) bloomLayer {
+	m := uint64(math.Ceil(-float64(capacity) * math.Log(errorRate) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := uint64(math.Ceil(-math.Log2(errorRate)))
+	return bloomLayer{
+		Bits:     make([]uint64, (m+63)/64),
+		M:        m,
+		K:        k,
+		Capacity: capacity,
+	}
+}
+
+// test 使用双重哈希检查k个位置，set为true时同时把这些位置置1，所有位置原来都是1时返回true
+func (l *bloomLayer) test(h1, h2 uint64, set bool) bool {
+	found := true
+	for i := uint64(0); i < l.K; i++ {
+		pos := (h1 + i*h2) % l.M
+		word, mask := pos/64, uint64(1)<<(pos%64)
+		if l.Bits[word]&mask == 0 {
+			found = false
+			if !set {
+				return false
+			}
+			l.Bits[word] |= mask
+		}
+	}
+	return found
+}
+
+// BloomFilter 可扩容的布隆过滤器，当前层满了之后新建一层，容量乘以Expansion，误判率乘以0.5，
+// Expansion为0时不扩容，满了之后加入会返回错误。
+// 位数组不导出，Get和Snapshot返回的过滤器只能用来判断类型，
+// 交出去之后第一次写入时会复制一份，之后没有再交出去就原地修改
+type BloomFilter struct {
+	errorRate float64      // 第一层的误判率
+	expansion uint64       // 扩容的倍数
+	layers    []bloomLayer // 所有的层，只向最后一层加入元素
+}
+
+// bloomState 持久化时使用的过滤器状态
+type bloomState struct {
+	ErrorRate float64
+	Expansion uint64
+	Layers    []bloomLayer
+}
+
+// GobEncode 持久化过滤器的状态
+func (bf *BloomFilter) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	st := bloomState{ErrorRate: bf.errorRate, Expansion: bf.expansion, Layers: bf.layers}
+	if err := gob.NewEncoder(&buf).Encode(st); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode 恢复持久化的过滤器状态
+func (bf *BloomFilter) GobDecode(data []byte) error {
+	var st bloomState
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&st); err != nil {
+		return err
+	}
+	*bf = BloomFilter{errorRate: st.ErrorRate, expansion: st.Expansion, layers: st.Layers}
+	return nil
+}
+
+// BloomInfo 布隆过滤器的统计信息
+type BloomInfo struct {
+	Capacity  uint64  // 所有层的总容量
+	Items     uint64  // 加入的元素数量
+	Layers    int     // 层数
+	Size      uint64  // 位数组占用的字节数
+	ErrorRate float64 // 第一层的误判率
+	Expansion uint64  // 扩容的倍数
+}
+
+func newBloomFilter(errorRate float64, capacity, expansion uint64) *BloomFilter {
+	return &BloomFilter{
+		errorRate: errorRate,
+		expansion: expansion,
+		layers:    []bloomLayer{newBloomLayer(capacity, errorRate)},
+	}
+}
+
+// clone 复制过滤器，只有最后一层会被修改，前面的层可以共享
+func (bf *BloomFilter) clone() *BloomFilter {
+	n := &BloomFilter{errorRate: bf.errorRate, expansion: bf.expansion, layers: append([]bloomLayer(nil), bf.layers...)}
+	last := &n.layers[len(n.layers)-1]
+	last.Bits = append([]uint64(nil), last.Bits...)
+	return n
+}
+
+func bloomHashes(item string) (uint64, uint64) {
+	h1 := hash64(item)
+	h2 := hash64(item+"\x00") | 1
+	return h1, h2
+}
+
+// exists 判断元素是否可能已经加入
+func (bf *BloomFilter) exists(item string) bool {
+	h1, h2 := bloomHashes(item)
+	for i := range bf.layers {
+		if bf.layers[i].test(h1, h2, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// add 加入一个元素，元素可能已经存在时返回false
+func (bf *BloomFilter) add(item string) (bool, error) {
+	if bf.exists(item) {
+		return false, nil
+	}
+
+	last := &bf.layers[len(bf.layers)-1]
+	if last.Count >= last.Capacity {
+		if bf.expansion == 0 {
+			return false, fmt.Errorf("bloom filter is full")
+		}
+		errorRate := bf.errorRate * math.Pow(bloomTightening, float64(len(bf.layers)))
+		bf.layers = append(bf.layers, newBloomLayer(last.Capacity*bf.expansion, errorRate))
+		last = &bf.layers[len(bf.layers)-1]
+	}
+
+	h1, h2 := bloomHashes(item)
+	last.test(h1, h2, true)
+	last.Count++
+	return true, nil
+}
+
+func (bf *BloomFilter) info() BloomInfo {
+	info := BloomInfo{
+		Layers:    len(bf.layers),
+		ErrorRate: bf.errorRate,
+		Expansion: bf.expansion,
+	}
+	for _, l := range bf.layers {
+		info.Capacity += l.Capacity
+		info.Items += l.Count
+		info.Size += uint64(len(l.Bits)) * 8
+	}
+	return info
+}
+
+// getBloom 获取key对应的布隆过滤器，key不存在或者已经过期时返回false，外部加锁
+func (c *Cache) getBloom(k string) (*BloomFilter, bool, error) {
+	item, ok := c.lookup(k)
+	if !ok {
+		return nil, false, nil
+	}
+	bf, ok := item.Object.(*BloomFilter)
+	if !ok {
+		return nil, false, fmt.Errorf("the value for %s is not a bloom filter", k)
+	}
+	return bf, true, nil
+}
+
+// BFReserve 新建一个布隆过滤器，errorRate是期望的误判率，capacity是第一层的容量，
+// expansion是满了之后新一层容量的倍数，为0时不扩容，key已经存在时返回错误
+func (c *Cache) BFReserve(k string, errorRate float64, capacity, expansion uint64) error {
+	if errorRate <= 0 || errorRate >= 1 {
+		return fmt.Errorf("error rate must be between 0 and 1")
+	}
+	if capacity == 0 {
+		return fmt.Errorf("capacity must be positive")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.lookup(k); ok {
+		return fmt.Errorf("Item %s already exists", k)
+	}
+	c.add(k, newBloomFilter(errorRate, capacity, expansion), DefaultExpiration)
+	return nil
+}
+
+// BFAdd 向布隆过滤器中加入元素，元素可能已经存在时返回false，
+// key不存在时使用默认的参数和过期时间新建
+func (c *Cache) BFAdd(k, item string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bf, ok, err := c.getBloom(k)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		bf = newBloomFilter(defaultBloomErrorRate, defaultBloomCapacity, defaultBloomExpansion)
+		c.add(k, bf, DefaultExpiration)
+	} else if bf.exists(item) {
+		return false, nil
+	} else if !c.owns(k) {
+		bf = bf.clone()
+	}
+	added, err := bf.add(item)
+	c.update(k, bf)
+	c.own(k)
+	return added, err
+}
+
+// BFExists 判断元素是否可能在布隆过滤器中，返回false时一定不在
+func (c *Cache) BFExists(k, item string) (bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	bf, ok, err := c.getBloom(k)
+	if err != nil || !ok {
+		return false, err
+	}
+	return bf.exists(item), nil
+}
+
+// BFInfo 返回布隆过滤器的统计信息
+func (c *Cache) BFInfo(k string) (BloomInfo, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	bf, ok, err := c.getBloom(k)
+	if err != nil {
+		return BloomInfo{}, err
+	}
+	if !ok {
+		return BloomInfo{}, fmt.Errorf("item %s not found", k)
+	}
+	return bf.info(), nil
+}
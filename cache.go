@@ -1,26 +1,40 @@
 package cache
 
 import (
+	"container/heap"
 	"fmt"
 	"os"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Cache struct {
-	defaultExpiration time.Duration      // 默认过期时间
-	items             map[string]Item    // 存放数据
-	delMap            map[string]delItem // 存放被删除的数据
-	prefixTree        *trie              // 提供key的前缀查询
-	mu                sync.RWMutex       // 读写锁
-	size              int                // 记录当前的cache中key的数量
-	gc                *garcoll           // 自动清理过期的key
-	persistSeq        int                // 持久化文件的序号
+	defaultExpiration time.Duration       // 默认过期时间
+	items             map[string]Item     // 存放数据
+	delMap            map[string]delItem  // 存放被删除的数据
+	prefixTree        *trie               // 提供key的前缀查询
+	mu                sync.RWMutex        // 读写锁
+	size              int                 // 记录当前的cache中key的数量
+	gc                *garcoll            // 自动清理过期的key
+	persistSeq        int                 // 持久化文件的序号
+	indexes           map[string]*index   // 二级索引
+	watchers          map[string]*watcher // 等待key发生变化的通道
+	hotKeys           atomic.Value        // 热点key统计，没有开启时为nil
+	slab              *slabStore          // []byte的slab存储，没有开启时为nil
+	compression       *compression        // string和[]byte的压缩配置，没有开启时为nil
+	encryption        *encryption         // 持久化文件的加密配置，没有开启时为nil
+	shared            uint64              // 读取接口把value交给外部的次数，读锁下也会更新，必须原子操作
+	owned             map[string]uint64   // 写入方复制出来的value -> 复制时的shared，见owns
 }
 
-// NewClient 新建一个Cache客户端，需要传入的参数是默认的到期时间和过期清理周期
-func NewClient(expiredTime time.Duration, cleanupInterval time.Duration) *Cache {
+// Option NewClient的可选配置
+type Option func(*Cache)
+
+// NewClient 新建一个Cache客户端，需要传入的参数是默认的到期时间和过期清理周期，
+// opts是可选的配置，比如WithSlabStorage、WithCompression和WithEncryption
+func NewClient(expiredTime time.Duration, cleanupInterval time.Duration, opts ...Option) *Cache {
 	cache := &Cache{
 		defaultExpiration: expiredTime,
 		items:             make(map[string]Item),
@@ -29,11 +43,17 @@ func NewClient(expiredTime time.Duration, cleanupInterval time.Duration) *Cache
 		mu:                sync.RWMutex{},
 		size:              0,
 		persistSeq:        1,
+		indexes:           make(map[string]*index),
+		watchers:          make(map[string]*watcher),
+		owned:             make(map[string]uint64),
 		gc: &garcoll{
 			interval: cleanupInterval,
 			stop:     make(chan bool),
 		},
 	}
+	for _, opt := range opts {
+		opt(cache)
+	}
 
 	go cache.gc.Run(cache)
 	return cache
@@ -51,16 +71,21 @@ func (c *Cache) Set(k string, x interface{}, d time.Duration) {
 		e = time.Now().Add(d).UnixNano()
 	}
 
-	// 写入
+	// 写入，覆盖未过期的key时保留它在Suggest里的排名
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.items[k] = Item{
+	fresh := !c.alive(k)
+	c.setItem(k, Item{
 		itemType:   c.getType(x),
 		Object:     x,
 		Expiration: e,
-	}
+	})
 	c.size++
-	c.insertKey(k)
+	if fresh {
+		c.insertKey(k)
+	}
+	c.indexSet(k, x)
+	c.touchHotKey(k)
 }
 
 // SetDefault 使用默认的过期时间写入，不用传入过期时间
@@ -77,9 +102,7 @@ func (c *Cache) Add(k string, x interface{}, d time.Duration) error {
 		return fmt.Errorf("Item %s already exists", k)
 	}
 
-	c.set(k, x, d)
-	c.insertKey(k)
-	c.size++
+	c.add(k, x, d)
 	return nil
 }
 
@@ -101,15 +124,18 @@ func (c *Cache) Get(k string) (interface{}, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	item, ok := c.items[k]
+	item, ok := c.getItem(k)
 	if !ok {
 		return nil, false
 	}
 
-	if c.items[k].expired() {
-		c.autoDelete(k)
+	// 读锁下不能删除，过期的key交给gc清理
+	if item.expired() {
 		return nil, false
 	}
+	c.prefixTree.hit(k)
+	c.touchHotKey(k)
+	c.share()
 	return item.Object, true
 }
 
@@ -119,18 +145,18 @@ func (c *Cache) GetWithExpiration(k string) (interface{}, time.Time, bool) {
 	defer c.mu.RUnlock()
 
 	// 不存在这个key
-	item, ok := c.items[k]
+	item, ok := c.getItem(k)
 	if !ok {
 		return nil, time.Time{}, false
 	}
 
-	// 过期
-	if c.items[k].expired() {
-		c.autoDelete(k)
+	// 过期，读锁下不能删除，交给gc清理
+	if item.expired() {
 		return nil, time.Time{}, false
 	}
 
 	// todo: 把int64转为时间 应该是还剩多少时间过期
+	c.share()
 	return item.Object, time.Time{}, true
 }
 
@@ -140,94 +166,75 @@ func (c *Cache) Delete(k string) {
 	defer c.mu.Unlock()
 
 	// 不存在这个key，其实也应该返回true
-	if _, ok := c.items[k]; !ok {
+	if _, ok := c.itemExpiration(k); !ok {
 		return
 	}
 
 	c.manualDelete(k)
 }
 
-// Increment 为指定的key增加n，
-// key对应的value必须是一个数字类型
-func (c *Cache) Increment(k string, n interface{}) (interface{}, error) {
+// GetAndSet 写入新的value并返回原来的value，key不存在或者已经过期时返回false
+func (c *Cache) GetAndSet(k string, x interface{}, d time.Duration) (interface{}, bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	// 当前key不存在
-	val, ok := c.items[k]
-	if !ok || val.expired() {
-		return nil, fmt.Errorf("item %s not found", k)
-	}
+	item, ok := c.lookup(k)
+	c.put(k, x, d)
+	c.touchHotKey(k)
+	return item.Object, ok
+}
 
-	switch n.(type) {
-	case int:
-		return c.incrementInt(k, n)
-	case int8:
-		return c.incrementInt8(k, n)
-	case int16:
-		return c.incrementInt16(k, n)
-	case int32:
-		return c.incrementInt32(k, n)
-	case int64:
-		return c.incrementInt64(k, n)
-	case uint:
-		return c.incrementUint(k, n)
-	case uint8:
-		return c.incrementUint8(k, n)
-	case uint16:
-		return c.incrementUint16(k, n)
-	case uint32:
-		return c.incrementUint32(k, n)
-	case uint64:
-		return c.incrementUint64(k, n)
-	case float32:
-		return c.incrementFloat32(k, n)
-	case float64:
-		return c.incrementFloat64(k, n)
-	default:
-		return nil, fmt.Errorf("the value for %s can not be increased", k)
+// GetAndDelete 删除指定的key并返回原来的value，key不存在或者已经过期时返回false
+func (c *Cache) GetAndDelete(k string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.lookup(k)
+	if !ok {
+		return nil, false
 	}
+	c.manualDelete(k)
+	return item.Object, true
 }
 
-//
-func (c *Cache) Decrement(k string, n interface{}) (interface{}, error) {
+// GetAndTouch 获取指定key对应的value并重新设置过期时间，key不存在或者已经过期时返回false
+func (c *Cache) GetAndTouch(k string, d time.Duration) (interface{}, bool) {
+	var e int64
+	if d == DefaultExpiration {
+		d = c.defaultExpiration
+	}
+	if d > 0 {
+		e = time.Now().Add(d).UnixNano()
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	val, ok := c.items[k]
-	if !ok || val.expired() {
-		c.autoDelete(k)
-		return nil, fmt.Errorf("item %s not found", k)
+	item, ok := c.lookup(k)
+	if !ok {
+		return nil, false
 	}
+	item.Expiration = e
+	c.setItem(k, item)
+	c.touchHotKey(k)
+	c.share()
+	return item.Object, true
+}
 
-	switch n.(type) {
-	case int:
-		return c.decrementInt(k, n)
-	case int8:
-		return c.decrementInt8(k, n)
-	case int16:
-		return c.decrementInt16(k, n)
-	case int32:
-		return c.decrementInt32(k, n)
-	case int64:
-		return c.decrementInt64(k, n)
-	case uint:
-		return c.decrementUint(k, n)
-	case uint8:
-		return c.decrementUint8(k, n)
-	case uint16:
-		return c.decrementUint16(k, n)
-	case uint32:
-		return c.decrementUint32(k, n)
-	case uint64:
-		return c.decrementUint64(k, n)
-	case float32:
-		return c.decrementFloat32(k, n)
-	case float64:
-		return c.decrementFloat64(k, n)
-	default:
-		return nil, fmt.Errorf("the value for %s can not be decreased", k)
-	}
+// Increment 为指定的key增加n，key必须存在且对应的value必须是一个数字类型，
+// n可以是任意能无损转换成value类型的数字，溢出时返回错误
+func (c *Cache) Increment(k string, n interface{}) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.addNumber(k, n, false, false, CounterOptions{})
+}
+
+// Decrement 为指定的key减少n，key必须存在且对应的value必须是一个数字类型，
+// n可以是任意能无损转换成value类型的数字，溢出时返回错误
+func (c *Cache) Decrement(k string, n interface{}) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.addNumber(k, n, true, false, CounterOptions{})
 }
 
 // 关于map的操作
@@ -238,10 +245,8 @@ func (c *Cache) IsExistedKey(k string) bool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	if _, ok := c.items[k]; ok {
-		return true
-	}
-	return false
+	_, ok := c.itemExpiration(k)
+	return ok
 }
 
 // IsExistedKeyWithPrefix 查询某个前缀是否存在
@@ -251,6 +256,74 @@ func (c *Cache) IsExistedKeyWithPrefix(prefix string) bool {
 	return c.searchWithPrefix(prefix)
 }
 
+// ListResult 按层级列出key的结果
+type ListResult struct {
+	Keys           []string // 当前层级下的key
+	CommonPrefixes []string // 当前层级下的子目录，以分隔符结尾
+	IsTruncated    bool     // 是否还有下一页
+	NextMarker     string   // 下一页的起始位置，作为marker传入
+}
+
+// List 像目录一样按层级列出指定前缀下的key，
+// delimiter为空时不做折叠，返回前缀下所有的key；
+// marker为上一页返回的NextMarker，maxKeys小于等于0时使用默认的分页大小
+func (c *Cache) List(prefix, delimiter, marker string, maxKeys int) ListResult {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxKeys
+	}
+	l := &lister{
+		c:         c,
+		prefix:    prefix,
+		delimiter: delimiter,
+		marker:    marker,
+		maxKeys:   maxKeys,
+	}
+
+	node := c.prefixTree.searchPrefix(prefix)
+	if node == nil {
+		return l.res
+	}
+	l.walk(node, prefix)
+	return l.res
+}
+
+// Suggest 返回以prefix开头的排名前n的key，用于输入联想，
+// 排名使用SetScore指定的分数，没有指定时使用Get的访问次数，过期和删除的key会被忽略
+func (c *Cache) Suggest(prefix string, n int) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	node := c.prefixTree.searchPrefix(prefix)
+	if node == nil || n <= 0 {
+		return nil
+	}
+
+	h := &suggestHeap{}
+	c.collectSuggestions(node, prefix, n, h)
+	keys := make([]string, h.Len())
+	for i := len(keys) - 1; i >= 0; i-- {
+		keys[i] = heap.Pop(h).(suggestion).key
+	}
+	return keys
+}
+
+// SetScore 为key指定Suggest使用的排序分数，key不存在时返回错误
+func (c *Cache) SetScore(k string, score float64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.alive(k) {
+		return fmt.Errorf("item %s not found", k)
+	}
+	node := c.prefixTree.searchPrefix(k)
+	node.score = score
+	node.scored = true
+	return nil
+}
+
 // Persist 持久化缓存数据到磁盘，包括有效数据和被删除的数据
 func (c *Cache) Persist() error {
 	c.mu.Lock()
@@ -302,14 +375,15 @@ func (c *Cache) Items() map[string]Item {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	m := make(map[string]Item, len(c.items))
+	c.share()
+	m := make(map[string]Item, c.itemCount())
 	now := time.Now().UnixNano()
-	for k, v := range c.items {
-		if v.Expiration > 0 && now > v.Expiration {
-			continue
+	c.rangeItems(func(k string, v Item) bool {
+		if v.Expiration == 0 || now <= v.Expiration {
+			m[k] = v
 		}
-		m[k] = v
-	}
+		return true
+	})
 	return m
 }
 
@@ -325,6 +399,13 @@ func (c *Cache) Flush() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.items = map[string]Item{}
+	c.owned = map[string]uint64{}
+	if c.slab != nil {
+		c.slab.reset()
+	}
+	for name, idx := range c.indexes {
+		c.indexes[name] = newIndex(idx.extractor)
+	}
 }
 
 func (c *Cache) StopGC() {
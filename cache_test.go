@@ -60,6 +60,55 @@ func TestDelete(t *testing.T) {
 	require.Equal(t, true, ok)
 }
 
+func TestGetAnd(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	old, ok := c.GetAndSet("k", 1, DefaultExpiration)
+	require.False(t, ok)
+	require.Nil(t, old)
+	old, ok = c.GetAndSet("k", 2, DefaultExpiration)
+	require.True(t, ok)
+	require.Equal(t, 1, old)
+
+	// 并发的GetAndSet每个旧值只会被读到一次
+	var wg sync.WaitGroup
+	seen := make(chan interface{}, 100)
+	for i := 3; i < 103; i++ {
+		wg.Add(1)
+		go func(v int) {
+			defer wg.Done()
+			old, _ := c.GetAndSet("k", v, DefaultExpiration)
+			seen <- old
+		}(i)
+	}
+	wg.Wait()
+	close(seen)
+	uniq := make(map[interface{}]bool)
+	for v := range seen {
+		require.False(t, uniq[v])
+		uniq[v] = true
+	}
+
+	v, ok := c.GetAndTouch("k", time.Millisecond)
+	require.True(t, ok)
+	require.NotNil(t, v)
+	time.Sleep(2 * time.Millisecond)
+	_, ok = c.Get("k")
+	require.False(t, ok)
+	_, ok = c.GetAndTouch("k", time.Minute)
+	require.False(t, ok)
+
+	c.Set("d", "x", DefaultExpiration)
+	v, ok = c.GetAndDelete("d")
+	require.True(t, ok)
+	require.Equal(t, "x", v)
+	require.False(t, c.IsExistedKey("d"))
+	require.True(t, c.SearchDel("d"))
+	_, ok = c.GetAndDelete("d")
+	require.False(t, ok)
+}
+
 func TestAutoDelete(t *testing.T) {
 	time.Sleep(10 * time.Second)
 
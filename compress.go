@@ -0,0 +1,226 @@
+package cache
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"io"
+)
+
+// Codec 压缩算法，Name会和压缩后的数据一起保存，解压时用来找到对应的Codec
+type Codec interface {
+	Name() string
+	Compress(src []byte) ([]byte, error)
+	Decompress(src []byte) ([]byte, error)
+}
+
+type flateCodec struct {
+	level int
+}
+
+// NewFlateCodec 使用compress/flate的Codec，level的取值和flate相同，不合法时使用默认级别
+func NewFlateCodec(level int) Codec {
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		level = flate.DefaultCompression
+	}
+	return flateCodec{level: level}
+}
+
+func (flateCodec) Name() string { return "flate" }
+
+func (f flateCodec) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, f.level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(src); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (flateCodec) Decompress(src []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(src))
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+type gzipCodec struct {
+	level int
+}
+
+// NewGzipCodec 使用compress/gzip的Codec，level的取值和gzip相同，不合法时使用默认级别
+func NewGzipCodec(level int) Codec {
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		level = gzip.DefaultCompression
+	}
+	return gzipCodec{level: level}
+}
+
+func (gzipCodec) Name() string { return "gzip" }
+
+func (g gzipCodec) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, g.level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(src); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCodec) Decompress(src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// builtinCodecs 没有配置压缩时也能解压标准库算法压缩的数据，比如加载别的cache持久化的文件
+var builtinCodecs = map[string]Codec{
+	"flate": NewFlateCodec(flate.DefaultCompression),
+	"gzip":  NewGzipCodec(gzip.DefaultCompression),
+}
+
+// compressedValue 压缩后保存的string或者[]byte，持久化时也保存这个形式
+type compressedValue struct {
+	Codec  string
+	String bool // 原来的value是不是string
+	Size   int  // 压缩前的长度
+	Data   []byte
+}
+
+func init() {
+	// 加载持久化文件时可能还没有写入过压缩的数据，需要提前注册
+	gob.Register(compressedValue{})
+}
+
+type compression struct {
+	threshold int
+	codec     Codec
+}
+
+// CompressionInfo 压缩的统计信息
+type CompressionInfo struct {
+	Values          int     // 压缩保存的value数量
+	OriginalBytes   int64   // 压缩前的总字节数
+	CompressedBytes int64   // 压缩后的总字节数
+	Ratio           float64 // 压缩后和压缩前的比值，没有压缩的数据时为0
+}
+
+// WithCompression 长度不小于threshold的string和[]byte写入时使用codec压缩，读取时自动解压，
+// 压缩后没有变小的数据按原样保存。codec为nil时使用默认级别的flate
+func WithCompression(threshold int, codec Codec) Option {
+	if codec == nil {
+		codec = NewFlateCodec(flate.DefaultCompression)
+	}
+	return func(c *Cache) {
+		c.compression = &compression{threshold: threshold, codec: codec}
+	}
+}
+
+// codec 按名字找到解压用的Codec，优先使用配置的Codec
+func (c *Cache) codec(name string) (Codec, bool) {
+	if c.compression != nil && c.compression.codec.Name() == name {
+		return c.compression.codec, true
+	}
+	codec, ok := builtinCodecs[name]
+	return codec, ok
+}
+
+// compress 按照配置压缩string和[]byte，不需要压缩时原样返回
+func (c *Cache) compress(x interface{}) interface{} {
+	if c.compression == nil {
+		return x
+	}
+	var src []byte
+	isString := false
+	switch v := x.(type) {
+	case string:
+		src, isString = []byte(v), true
+	case []byte:
+		src = v
+	default:
+		return x
+	}
+	if len(src) < c.compression.threshold {
+		return x
+	}
+	data, err := c.compression.codec.Compress(src)
+	if err != nil || len(data) >= len(src) {
+		return x
+	}
+	return compressedValue{Codec: c.compression.codec.Name(), String: isString, Size: len(src), Data: data}
+}
+
+// decompress 还原压缩保存的value，不是压缩的数据时原样返回
+func (c *Cache) decompress(x interface{}) (interface{}, error) {
+	cv, ok := x.(compressedValue)
+	if !ok {
+		return x, nil
+	}
+	codec, ok := c.codec(cv.Codec)
+	if !ok {
+		return nil, fmt.Errorf("codec %s is not configured", cv.Codec)
+	}
+	b, err := codec.Decompress(cv.Data)
+	if err != nil {
+		return nil, err
+	}
+	if cv.String {
+		return string(b), nil
+	}
+	return b, nil
+}
+
+// check 解压一遍检查数据是否完整，解压后的长度必须和压缩前的长度一致
+func (cv compressedValue) check(c *Cache) error {
+	x, err := c.decompress(cv)
+	if err != nil {
+		return err
+	}
+	var n int
+	switch v := x.(type) {
+	case string:
+		n = len(v)
+	case []byte:
+		n = len(v)
+	}
+	if n != cv.Size {
+		return fmt.Errorf("decompressed %d bytes, expected %d", n, cv.Size)
+	}
+	return nil
+}
+
+// CompressionStats 统计当前压缩保存的数据，包括还没有被gc清理的过期数据
+func (c *Cache) CompressionStats() CompressionInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var info CompressionInfo
+	c.rangeStored(func(_ string, item Item) bool {
+		if cv, ok := item.Object.(compressedValue); ok {
+			info.Values++
+			info.OriginalBytes += int64(cv.Size)
+			info.CompressedBytes += int64(len(cv.Data))
+		}
+		return true
+	})
+	if info.OriginalBytes > 0 {
+		info.Ratio = float64(info.CompressedBytes) / float64(info.OriginalBytes)
+	}
+	return info
+}
@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// rleCodec 测试用的游程编码Codec，没有注册到内置的Codec里
+type rleCodec struct{}
+
+func (rleCodec) Name() string { return "rle" }
+
+func (rleCodec) Compress(src []byte) ([]byte, error) {
+	var dst []byte
+	for i := 0; i < len(src); {
+		n := 1
+		for i+n < len(src) && src[i+n] == src[i] && n < 255 {
+			n++
+		}
+		dst = append(dst, src[i], byte(n))
+		i += n
+	}
+	return dst, nil
+}
+
+func (rleCodec) Decompress(src []byte) ([]byte, error) {
+	if len(src)%2 != 0 {
+		return nil, fmt.Errorf("invalid rle data")
+	}
+	var dst []byte
+	for i := 0; i < len(src); i += 2 {
+		dst = append(dst, bytes.Repeat(src[i:i+1], int(src[i+1]))...)
+	}
+	return dst, nil
+}
+
+func TestCompression(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute, WithCompression(64, NewGzipCodec(-1)))
+	defer c.StopGC()
+
+	blob := strings.Repeat(`{"name":"cache","tags":["a","b"]},`, 100)
+	c.Set("json", blob, DefaultExpiration)
+	c.Set("bytes", []byte(blob), DefaultExpiration)
+	c.Set("small", "tiny", DefaultExpiration)
+
+	require.IsType(t, compressedValue{}, c.items["json"].Object)
+	require.IsType(t, compressedValue{}, c.items["bytes"].Object)
+	require.Equal(t, "tiny", c.items["small"].Object)
+
+	v, _ := c.Get("json")
+	require.Equal(t, blob, v)
+	v, _ = c.Get("bytes")
+	require.Equal(t, []byte(blob), v)
+	require.Equal(t, blob, c.Items()["json"].Object)
+	v, _ = c.Snapshot().Get("bytes")
+	require.Equal(t, []byte(blob), v)
+
+	n, err := c.StrLen("json")
+	require.NoError(t, err)
+	require.Equal(t, len(blob), n)
+	_, err = c.Append("json", "end")
+	require.NoError(t, err)
+	s, err := c.GetRange("json", -3, -1)
+	require.NoError(t, err)
+	require.Equal(t, "end", s)
+
+	info := c.CompressionStats()
+	require.Equal(t, 2, info.Values)
+	require.Equal(t, int64(2*len(blob)+3), info.OriginalBytes)
+	require.Less(t, info.Ratio, 0.2)
+
+	// 持久化的是压缩后的数据，没有配置压缩的cache也能用内置的Codec加载
+	var buf bytes.Buffer
+	require.NoError(t, c.saveItem(&buf))
+	require.Less(t, buf.Len(), len(blob))
+	c2 := NewClient(time.Minute, time.Minute)
+	defer c2.StopGC()
+	require.NoError(t, c2.load(&buf, 1))
+	v, _ = c2.Get("bytes")
+	require.Equal(t, []byte(blob), v)
+
+	// 自定义的Codec没有配置时加载失败
+	c3 := NewClient(time.Minute, time.Minute, WithCompression(0, rleCodec{}))
+	defer c3.StopGC()
+	raw := strings.Repeat("a", 300) + strings.Repeat("b", 10)
+	c3.Set("k", raw, DefaultExpiration)
+	require.Equal(t, compressedValue{Codec: "rle", String: true, Size: len(raw), Data: []byte{'a', 255, 'a', 45, 'b', 10}}, c3.items["k"].Object)
+	v, _ = c3.Get("k")
+	require.Equal(t, raw, v)
+	buf.Reset()
+	require.NoError(t, c3.saveItem(&buf))
+	require.Error(t, c2.load(&buf, 1))
+
+	// 损坏的压缩数据在加载时返回错误，不会在Get时当作不存在
+	c5 := NewClient(time.Minute, time.Minute, WithCompression(0, rleCodec{}))
+	defer c5.StopGC()
+	c3.mu.Lock()
+	cv := c3.items["k"].Object.(compressedValue)
+	c3.mu.Unlock()
+	corrupt := NewClient(time.Minute, time.Minute)
+	defer corrupt.StopGC()
+	corrupt.items["k"] = Item{Object: compressedValue{Codec: cv.Codec, String: true, Size: cv.Size, Data: cv.Data[:3]}}
+	corrupt.items["short"] = Item{Object: compressedValue{Codec: cv.Codec, String: true, Size: cv.Size, Data: cv.Data[:4]}}
+	var bad bytes.Buffer
+	require.NoError(t, corrupt.saveItem(&bad))
+	err = c5.load(&bad, 1)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "corrupted")
+	require.False(t, c5.IsExistedKey("k"))
+	delete(corrupt.items, "k")
+	bad.Reset()
+	require.NoError(t, corrupt.saveItem(&bad))
+	require.Error(t, c5.load(&bad, 1))
+
+	// 配置了同样的Codec时可以加载
+	buf.Reset()
+	require.NoError(t, c3.saveItem(&buf))
+	c4 := NewClient(time.Minute, time.Minute, WithCompression(0, rleCodec{}))
+	defer c4.StopGC()
+	require.NoError(t, c4.load(&buf, 1))
+	v, _ = c4.Get("k")
+	require.Equal(t, raw, v)
+}
+
+func TestCompressionWithSlab(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute, WithSlabStorage(2, 1024), WithCompression(64, nil))
+	defer c.StopGC()
+
+	blob := bytes.Repeat([]byte("slab-compressed "), 100)
+	c.Set("k", blob, DefaultExpiration)
+	require.Empty(t, c.items)
+	_, _, flags, ok := c.slab.get("k")
+	require.True(t, ok)
+	require.Equal(t, slabCompressed, flags)
+
+	v, _ := c.Get("k")
+	require.Equal(t, blob, v)
+	info := c.CompressionStats()
+	require.Equal(t, 1, info.Values)
+	require.Equal(t, int64(len(blob)), info.OriginalBytes)
+
+	var buf bytes.Buffer
+	require.NoError(t, c.saveItem(&buf))
+	c2 := NewClient(time.Minute, time.Minute, WithSlabStorage(2, 1024))
+	defer c2.StopGC()
+	require.NoError(t, c2.load(&buf, 1))
+	v, _ = c2.Get("k")
+	require.Equal(t, blob, v)
+}
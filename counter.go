@@ -0,0 +1,187 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultCounterWidth     = time.Second // 默认每个桶的时间宽度
+	defaultCounterRetention = time.Hour   // 默认保留的时间
+)
+
+// RollingCounter 按时间分桶的滚动计数器，只保留最近Retention时间内的桶，
+// 过期的桶在gc时清理，超过Retention没有写入时整个key过期。
+// 桶会被原地修改，所以不导出，Get和Snapshot返回的计数器只能用来判断类型
+type RollingCounter struct {
+	width     int64           // 每个桶的时间宽度
+	retention int64           // 保留的时间
+	buckets   map[int64]int64 // 桶的序号 -> 计数，序号是桶的起始时间除以width
+}
+
+// counterState 持久化时使用的计数器状态
+type counterState struct {
+	Width     int64
+	Retention int64
+	Buckets   map[int64]int64
+}
+
+func newRollingCounter(width, retention time.Duration) *RollingCounter {
+	return &RollingCounter{
+		width:     int64(width),
+		retention: int64(retention),
+		buckets:   make(map[int64]int64),
+	}
+}
+
+// GobEncode 持久化计数器的状态
+func (rc *RollingCounter) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	st := counterState{Width: rc.width, Retention: rc.retention, Buckets: rc.buckets}
+	if err := gob.NewEncoder(&buf).Encode(st); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode 恢复持久化的计数器状态，gob不会编码空的map，需要重新初始化
+func (rc *RollingCounter) GobDecode(data []byte) error {
+	var st counterState
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&st); err != nil {
+		return err
+	}
+	*rc = RollingCounter{width: st.Width, retention: st.Retention, buckets: st.Buckets}
+	if rc.buckets == nil {
+		rc.buckets = make(map[int64]int64)
+	}
+	return nil
+}
+
+// clone 复制计数器，修改交出去过的计数器之前必须复制
+func (rc *RollingCounter) clone() *RollingCounter {
+	n := &RollingCounter{width: rc.width, retention: rc.retention, buckets: make(map[int64]int64, len(rc.buckets))}
+	for idx, v := range rc.buckets {
+		n.buckets[idx] = v
+	}
+	return n
+}
+
+// sweep 返回删除超出保留时间的桶之后的副本，没有需要删除的桶时返回nil，
+// 删除之后没有剩余的桶时empty为true，刚新建还没有计数的计数器不会被删除
+func (rc *RollingCounter) sweep(now int64) (interface{}, bool) {
+	oldest := (now - rc.retention) / rc.width
+	for idx := range rc.buckets {
+		if idx <= oldest {
+			n := newRollingCounter(time.Duration(rc.width), time.Duration(rc.retention))
+			for idx, v := range rc.buckets {
+				if idx > oldest {
+					n.buckets[idx] = v
+				}
+			}
+			return n, len(n.buckets) == 0
+		}
+	}
+	return nil, false
+}
+
+// sum 统计最近window时间内的计数，包括当前还没有结束的桶
+func (rc *RollingCounter) sum(now int64, window time.Duration) int64 {
+	if int64(window) > rc.retention {
+		window = time.Duration(rc.retention)
+	}
+	oldest := (now - int64(window)) / rc.width
+	var n int64
+	for idx, v := range rc.buckets {
+		if idx > oldest {
+			n += v
+		}
+	}
+	return n
+}
+
+// getCounter 获取key对应的滚动计数器，key不存在或者已经过期时返回false，外部加锁
+func (c *Cache) getCounter(k string) (*RollingCounter, bool, error) {
+	item, ok := c.lookup(k)
+	if !ok {
+		return nil, false, nil
+	}
+	rc, ok := item.Object.(*RollingCounter)
+	if !ok {
+		return nil, false, fmt.Errorf("the value for %s is not a rolling counter", k)
+	}
+	return rc, true, nil
+}
+
+// CreateRollingCounter 新建一个滚动计数器，width是每个桶的时间宽度，retention是保留的时间，
+// key已经存在时返回错误
+func (c *Cache) CreateRollingCounter(k string, width, retention time.Duration) error {
+	if width <= 0 || retention < width {
+		return fmt.Errorf("width must be positive and no more than retention")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.lookup(k); ok {
+		return fmt.Errorf("Item %s already exists", k)
+	}
+	c.add(k, newRollingCounter(width, retention), retention)
+	return nil
+}
+
+// Incr 在当前时间的桶上增加n，返回当前桶的计数，
+// key不存在时使用默认的桶宽度和保留时间新建
+func (c *Cache) Incr(k string, n int64) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rc, ok, err := c.getCounter(k)
+	if err != nil {
+		return 0, err
+	}
+	// Get和Snapshot返回的计数器可能还在被读取，交出去之后第一次写入时复制一份
+	if !ok {
+		rc = newRollingCounter(defaultCounterWidth, defaultCounterRetention)
+	} else if !c.owns(k) {
+		rc = rc.clone()
+	}
+
+	idx := time.Now().UnixNano() / rc.width
+	rc.buckets[idx] += n
+	c.put(k, rc, time.Duration(rc.retention))
+	c.own(k)
+	return rc.buckets[idx], nil
+}
+
+// Sum 返回最近window时间内的计数，window超过保留时间时按保留时间计算，精度是一个桶的宽度
+func (c *Cache) Sum(k string, window time.Duration) (int64, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	rc, ok, err := c.getCounter(k)
+	if err != nil || !ok {
+		return 0, err
+	}
+	return rc.sum(time.Now().UnixNano(), window), nil
+}
+
+// Rate 返回最近window时间内平均每秒的计数
+func (c *Cache) Rate(k string, window time.Duration) (float64, error) {
+	if window <= 0 {
+		return 0, fmt.Errorf("window must be positive")
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	rc, ok, err := c.getCounter(k)
+	if err != nil || !ok {
+		return 0, err
+	}
+	if int64(window) > rc.retention {
+		window = time.Duration(rc.retention)
+	}
+	return float64(rc.sum(time.Now().UnixNano(), window)) / window.Seconds(), nil
+}
@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollingCounter(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	require.Error(t, c.CreateRollingCounter("bad", 0, time.Hour))
+	require.Error(t, c.CreateRollingCounter("bad", -time.Second, time.Hour))
+	require.Error(t, c.CreateRollingCounter("bad", time.Hour, time.Second))
+	require.False(t, c.IsExistedKey("bad"))
+
+	// 桶宽度取一小时，测试期间当前桶不会变化
+	require.NoError(t, c.CreateRollingCounter("c", time.Hour, 10*time.Hour))
+	require.Error(t, c.CreateRollingCounter("c", time.Hour, 10*time.Hour))
+
+	n, err := c.Incr("c", 2)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), n)
+	n, err = c.Incr("c", 3)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), n)
+
+	// 在之前的桶里放入计数，模拟跨越多个桶的写入
+	cur := time.Now().UnixNano() / int64(time.Hour)
+	c.mu.Lock()
+	rc := c.items["c"].Object.(*RollingCounter)
+	rc.buckets[cur-1] = 10
+	rc.buckets[cur-2] = 100
+	rc.buckets[cur-9] = 1000
+	rc.buckets[cur-10] = 10000
+	c.mu.Unlock()
+
+	sum, err := c.Sum("c", time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), sum)
+	sum, _ = c.Sum("c", 2*time.Hour)
+	require.Equal(t, int64(15), sum)
+	sum, _ = c.Sum("c", 3*time.Hour)
+	require.Equal(t, int64(115), sum)
+	// window超过保留时间时按保留时间计算，保留时间之外的桶不计入
+	sum, _ = c.Sum("c", 10*time.Hour)
+	require.Equal(t, int64(1115), sum)
+	sum, _ = c.Sum("c", 100*time.Hour)
+	require.Equal(t, int64(1115), sum)
+
+	rate, err := c.Rate("c", 3*time.Hour)
+	require.NoError(t, err)
+	require.InDelta(t, 115.0/(3*3600), rate, 1e-9)
+	rate, _ = c.Rate("c", 100*time.Hour)
+	require.InDelta(t, 1115.0/(10*3600), rate, 1e-9)
+	_, err = c.Rate("c", 0)
+	require.Error(t, err)
+
+	sum, err = c.Sum("missing", time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), sum)
+
+	// key不存在时使用默认配置新建
+	n, err = c.Incr("auto", 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+	sum, _ = c.Sum("auto", time.Minute)
+	require.Equal(t, int64(1), sum)
+
+	c.Set("str", "a", DefaultExpiration)
+	_, err = c.Incr("str", 1)
+	require.Error(t, err)
+	_, err = c.Sum("str", time.Hour)
+	require.Error(t, err)
+
+	// 持久化之后可以继续计数
+	var buf bytes.Buffer
+	require.NoError(t, c.saveItem(&buf))
+	c2 := NewClient(time.Minute, time.Minute)
+	defer c2.StopGC()
+	require.NoError(t, c2.load(&buf, 1))
+	sum, err = c2.Sum("c", 100*time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, int64(1115), sum)
+	n, err = c2.Incr("c", 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(6), n)
+}
+
+func TestRollingCounterSweep(t *testing.T) {
+	rc := newRollingCounter(time.Second, 10*time.Second)
+	now := time.Now().UnixNano()
+	cur := now / int64(time.Second)
+
+	// 刚新建还没有计数的计数器不会被清理
+	swept, empty := rc.sweep(now)
+	require.Nil(t, swept)
+	require.False(t, empty)
+
+	rc.buckets[cur] = 1
+	rc.buckets[cur-9] = 2
+	swept, empty = rc.sweep(now)
+	require.Nil(t, swept)
+	require.False(t, empty)
+
+	rc.buckets[cur-10] = 4
+	rc.buckets[cur-20] = 8
+	swept, empty = rc.sweep(now)
+	require.False(t, empty)
+	require.Equal(t, map[int64]int64{cur: 1, cur - 9: 2}, swept.(*RollingCounter).buckets)
+	// 清理写到副本里，原来的计数器不变
+	require.Len(t, rc.buckets, 4)
+
+	old := newRollingCounter(time.Second, 10*time.Second)
+	old.buckets[cur-10] = 1
+	swept, empty = old.sweep(now)
+	require.True(t, empty)
+	require.Empty(t, swept.(*RollingCounter).buckets)
+
+	// gc清理过期的桶，所有桶都过期时删除key
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	require.NoError(t, c.CreateRollingCounter("c", time.Second, 10*time.Second))
+	require.NoError(t, c.CreateRollingCounter("idle", time.Second, 10*time.Second))
+	require.NoError(t, c.CreateRollingCounter("old", time.Second, 10*time.Second))
+	_, err := c.Incr("c", 1)
+	require.NoError(t, err)
+	c.mu.Lock()
+	c.items["c"].Object.(*RollingCounter).buckets[cur-20] = 2
+	c.items["old"].Object.(*RollingCounter).buckets[cur-20] = 2
+	c.mu.Unlock()
+
+	c.delete()
+	sum, err := c.Sum("c", 10*time.Second)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), sum)
+	c.mu.RLock()
+	require.Len(t, c.items["c"].Object.(*RollingCounter).buckets, 1)
+	c.mu.RUnlock()
+	require.True(t, c.IsExistedKey("idle"))
+	require.False(t, c.IsExistedKey("old"))
+}
+
+func TestRollingCounterCopyOnWrite(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	require.NoError(t, c.CreateRollingCounter("c", time.Hour, 10*time.Hour))
+	_, err := c.Incr("c", 1)
+	require.NoError(t, err)
+	s := c.Snapshot()
+	_, err = c.Incr("c", 2)
+	require.NoError(t, err)
+
+	// 快照里的计数器不受之后的写入影响
+	v, _ := s.Get("c")
+	require.Equal(t, int64(1), v.(*RollingCounter).sum(time.Now().UnixNano(), 10*time.Hour))
+	sum, _ := c.Sum("c", 10*time.Hour)
+	require.Equal(t, int64(3), sum)
+
+	// 没有交出去的计数器原地修改
+	first := c.items["c"].Object
+	_, err = c.Incr("c", 1)
+	require.NoError(t, err)
+	require.Same(t, first, c.items["c"].Object)
+}
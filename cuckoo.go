@@ -0,0 +1,285 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"math/rand"
+)
+
+const (
+	defaultCuckooCapacity = 1024 // 默认的容量
+	cuckooBucketSize      = 4    // 每个桶的指纹数量
+	cuckooMaxKicks        = 500  // 插入时最多踢出的次数
+)
+
+// CuckooFilter 布谷鸟过滤器，每个元素保存一个16位的指纹，支持删除，
+// 每个桶4个指纹时误判率约为 2*4/65536 = 0.012%。
+// 桶不导出，Get和Snapshot返回的过滤器只能用来判断类型，
+// 交出去之后第一次写入时会复制一份，之后没有再交出去就原地修改
+type CuckooFilter struct {
+	buckets    []uint16 // 所有桶的指纹，0表示空位
+	numBuckets uint64   // 桶的数量，是2的幂
+	count      uint64   // 加入的元素数量
+	deletes    uint64   // 删除的元素数量
+}
+
+// cuckooState 持久化时使用的过滤器状态
+type cuckooState struct {
+	Buckets    []uint16
+	NumBuckets uint64
+	Count      uint64
+	Deletes    uint64
+}
+
+// GobEncode 持久化过滤器的状态
+func (cf *CuckooFilter) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	st := cuckooState{Buckets: cf.buckets, NumBuckets: cf.numBuckets, Count: cf.count, Deletes: cf.deletes}
+	if err := gob.NewEncoder(&buf).Encode(st); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode 恢复持久化的过滤器状态
+func (cf *CuckooFilter) GobDecode(data []byte) error {
+	var st cuckooState
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&st); err != nil {
+		return err
+	}
+	*cf = CuckooFilter{buckets: st.Buckets, numBuckets: st.NumBuckets, count: st.Count, deletes: st.Deletes}
+	return nil
+}
+
+// CuckooInfo 布谷鸟过滤器的统计信息
+type CuckooInfo struct {
+	Buckets    uint64 // 桶的数量
+	BucketSize int    // 每个桶的指纹数量
+	Items      uint64 // 当前的元素数量
+	Deletes    uint64 // 删除的元素数量
+	Size       uint64 // 指纹占用的字节数
+}
+
+func newCuckooFilter(capacity uint64) *CuckooFilter {
+	n := uint64(1)
+	for n*cuckooBucketSize < capacity {
+		n <<= 1
+	}
+	return &CuckooFilter{
+		buckets:    make([]uint16, n*cuckooBucketSize),
+		numBuckets: n,
+	}
+}
+
+// position 返回元素的指纹和第一个候选桶
+func (cf *CuckooFilter) position(item string) (uint16, uint64) {
+	h := hash64(item)
+	fp := uint16(h >> 48)
+	if fp == 0 {
+		fp = 1
+	}
+	return fp, h & (cf.numBuckets - 1)
+}
+
+// altIndex 根据指纹计算另一个候选桶，两个桶可以互相计算
+func (cf *CuckooFilter) altIndex(i uint64, fp uint16) uint64 {
+	return (i ^ uint64(fp)*0x5bd1e995) & (cf.numBuckets - 1)
+}
+
+// clone 复制过滤器，修改交出去过的过滤器之前必须复制
+func (cf *CuckooFilter) clone() *CuckooFilter {
+	n := *cf
+	n.buckets = append([]uint16(nil), cf.buckets...)
+	return &n
+}
+
+// bucket 返回第i个桶
+func (cf *CuckooFilter) bucket(i uint64) []uint16 {
+	return cf.buckets[i*cuckooBucketSize : (i+1)*cuckooBucketSize]
+}
+
+// put 把指纹放进桶里的空位
+func (cf *CuckooFilter) put(i uint64, fp uint16) bool {
+	b := cf.bucket(i)
+	for j := range b {
+		if b[j] == 0 {
+			b[j] = fp
+			return true
+		}
+	}
+	return false
+}
+
+// contains 判断桶里是否有这个指纹
+func (cf *CuckooFilter) contains(i uint64, fp uint16) bool {
+	for _, x := range cf.bucket(i) {
+		if x == fp {
+			return true
+		}
+	}
+	return false
+}
+
+// add 加入一个元素，两个桶都满了时不断踢出已有的指纹，失败时恢复原样并返回错误
+func (cf *CuckooFilter) add(item string) error {
+	fp, i1 := cf.position(item)
+	i2 := cf.altIndex(i1, fp)
+	if cf.put(i1, fp) || cf.put(i2, fp) {
+		cf.count++
+		return nil
+	}
+
+	type kick struct {
+		bucket uint64
+		slot   int
+		fp     uint16
+	}
+	path := make([]kick, 0, cuckooMaxKicks)
+	i := i1
+	if rand.Intn(2) == 1 {
+		i = i2
+	}
+	for n := 0; n < cuckooMaxKicks; n++ {
+		slot := rand.Intn(cuckooBucketSize)
+		b := cf.bucket(i)
+		path = append(path, kick{i, slot, b[slot]})
+		fp, b[slot] = b[slot], fp
+		i = cf.altIndex(i, fp)
+		if cf.put(i, fp) {
+			cf.count++
+			return nil
+		}
+	}
+
+	// 恢复被踢出的指纹
+	for j := len(path) - 1; j >= 0; j-- {
+		cf.bucket(path[j].bucket)[path[j].slot] = path[j].fp
+	}
+	return fmt.Errorf("cuckoo filter is full")
+}
+
+// exists 判断元素是否可能已经加入
+func (cf *CuckooFilter) exists(item string) bool {
+	fp, i1 := cf.position(item)
+	return cf.contains(i1, fp) || cf.contains(cf.altIndex(i1, fp), fp)
+}
+
+// del 删除一个元素的指纹，只能删除确实加入过的元素，否则可能误删其他元素
+func (cf *CuckooFilter) del(item string) bool {
+	fp, i1 := cf.position(item)
+	for _, i := range []uint64{i1, cf.altIndex(i1, fp)} {
+		b := cf.bucket(i)
+		for j := range b {
+			if b[j] == fp {
+				b[j] = 0
+				cf.count--
+				cf.deletes++
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getCuckoo 获取key对应的布谷鸟过滤器，key不存在或者已经过期时返回false，外部加锁
+func (c *Cache) getCuckoo(k string) (*CuckooFilter, bool, error) {
+	item, ok := c.lookup(k)
+	if !ok {
+		return nil, false, nil
+	}
+	cf, ok := item.Object.(*CuckooFilter)
+	if !ok {
+		return nil, false, fmt.Errorf("the value for %s is not a cuckoo filter", k)
+	}
+	return cf, true, nil
+}
+
+// CFReserve 新建一个能容纳capacity个元素的布谷鸟过滤器，key已经存在时返回错误
+func (c *Cache) CFReserve(k string, capacity uint64) error {
+	if capacity == 0 {
+		return fmt.Errorf("capacity must be positive")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.lookup(k); ok {
+		return fmt.Errorf("Item %s already exists", k)
+	}
+	c.add(k, newCuckooFilter(capacity), DefaultExpiration)
+	return nil
+}
+
+// CFAdd 向布谷鸟过滤器中加入元素，同一个元素可以加入多次，
+// key不存在时使用默认的容量和过期时间新建
+func (c *Cache) CFAdd(k, item string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cf, ok, err := c.getCuckoo(k)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		cf = newCuckooFilter(defaultCuckooCapacity)
+		c.add(k, cf, DefaultExpiration)
+	} else if !c.owns(k) {
+		cf = cf.clone()
+	}
+	err = cf.add(item)
+	c.update(k, cf)
+	c.own(k)
+	return err
+}
+
+// CFExists 判断元素是否可能在布谷鸟过滤器中，返回false时一定不在
+func (c *Cache) CFExists(k, item string) (bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	cf, ok, err := c.getCuckoo(k)
+	if err != nil || !ok {
+		return false, err
+	}
+	return cf.exists(item), nil
+}
+
+// CFDel 从布谷鸟过滤器中删除一次元素，元素不存在时返回false
+func (c *Cache) CFDel(k, item string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cf, ok, err := c.getCuckoo(k)
+	if err != nil || !ok || !cf.exists(item) {
+		return false, err
+	}
+	if !c.owns(k) {
+		cf = cf.clone()
+	}
+	deleted := cf.del(item)
+	c.update(k, cf)
+	c.own(k)
+	return deleted, nil
+}
+
+// CFInfo 返回布谷鸟过滤器的统计信息
+func (c *Cache) CFInfo(k string) (CuckooInfo, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	cf, ok, err := c.getCuckoo(k)
+	if err != nil {
+		return CuckooInfo{}, err
+	}
+	if !ok {
+		return CuckooInfo{}, fmt.Errorf("item %s not found", k)
+	}
+	return CuckooInfo{
+		Buckets:    cf.numBuckets,
+		BucketSize: cuckooBucketSize,
+		Items:      cf.count,
+		Deletes:    cf.deletes,
+		Size:       uint64(len(cf.buckets)) * 2,
+	}, nil
+}
@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/gob"
+	"fmt"
+	"io"
+)
+
+// 加密文件的布局：
+// | magic(6) | keyIDLen(1) | keyID | nonce(12) | ciphertext |
+// magic和keyID作为附加数据参与认证，修改文件的任何部分都会导致解密失败
+var encryptMagic = []byte("MCENC1")
+
+const maxKeyIDLen = 255
+
+// encryption 持久化文件的加密配置，keys保存所有可以用来解密的key，新文件使用active加密
+type encryption struct {
+	keys   map[string]cipher.AEAD
+	active string
+	err    error // 配置错误，在持久化和加载时返回
+}
+
+// WithEncryption 使用AES-GCM加密Persist写入的文件，Load时解密并校验，
+// keys是key ID到密钥的映射，密钥长度必须是16、24或者32字节，activeID是加密新文件使用的key ID。
+// 轮换密钥时加入新的key并把activeID换成它，旧的key保留到旧文件不再需要加载为止。
+// 配置错误时Persist和Load会返回错误
+func WithEncryption(keys map[string][]byte, activeID string) Option {
+	enc := &encryption{keys: make(map[string]cipher.AEAD, len(keys)), active: activeID}
+	for id, key := range keys {
+		if len(id) == 0 || len(id) > maxKeyIDLen {
+			enc.err = fmt.Errorf("the length of key id %q must be between 1 and %d", id, maxKeyIDLen)
+			break
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			enc.err = fmt.Errorf("invalid encryption key %s: %v", id, err)
+			break
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			enc.err = fmt.Errorf("invalid encryption key %s: %v", id, err)
+			break
+		}
+		enc.keys[id] = aead
+	}
+	if _, ok := enc.keys[activeID]; enc.err == nil && !ok {
+		enc.err = fmt.Errorf("active key %s is not in the keyring", activeID)
+	}
+	return func(c *Cache) {
+		c.encryption = enc
+	}
+}
+
+// header 返回文件头中参与认证的部分
+func encryptHeader(keyID string) []byte {
+	h := make([]byte, 0, len(encryptMagic)+1+len(keyID))
+	h = append(h, encryptMagic...)
+	h = append(h, byte(len(keyID)))
+	return append(h, keyID...)
+}
+
+// seal 使用当前的key加密plaintext并写到w
+func (e *encryption) seal(w io.Writer, plaintext []byte) error {
+	if e.err != nil {
+		return e.err
+	}
+	aead := e.keys[e.active]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	header := encryptHeader(e.active)
+	out := make([]byte, 0, len(header)+len(nonce)+len(plaintext)+aead.Overhead())
+	out = append(out, header...)
+	out = append(out, nonce...)
+	out = aead.Seal(out, nonce, plaintext, header)
+	_, err := w.Write(out)
+	return err
+}
+
+// open 读取r中的加密文件，校验并解密，key不对或者文件被修改时返回错误
+func (e *encryption) open(r io.Reader) ([]byte, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, encryptMagic) || len(data) < len(encryptMagic)+1 {
+		return nil, fmt.Errorf("the file is not encrypted")
+	}
+	n := len(encryptMagic) + 1 + int(data[len(encryptMagic)])
+	if len(data) < n {
+		return nil, fmt.Errorf("the encrypted file is truncated")
+	}
+	keyID := string(data[len(encryptMagic)+1 : n])
+	aead, ok := e.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("key %s is not in the keyring", keyID)
+	}
+	if len(data) < n+aead.NonceSize() {
+		return nil, fmt.Errorf("the encrypted file is truncated")
+	}
+	nonce := data[n : n+aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, data[n+aead.NonceSize():], data[:n])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt the file with key %s: wrong key or the file is tampered", keyID)
+	}
+	return plaintext, nil
+}
+
+// decryptReader 返回解密后的数据，没有配置加密时遇到加密的文件返回错误
+func (c *Cache) decryptReader(r io.Reader) (io.Reader, error) {
+	if c.encryption != nil {
+		plaintext, err := c.encryption.open(r)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(plaintext), nil
+	}
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(len(encryptMagic)); bytes.Equal(magic, encryptMagic) {
+		return nil, fmt.Errorf("the file is encrypted but no encryption key is configured")
+	}
+	return br, nil
+}
+
+// encode 使用gob编码v并写到w，配置了加密时写入加密后的数据
+func (c *Cache) encode(w io.Writer, v interface{}) error {
+	if c.encryption == nil {
+		return gob.NewEncoder(w).Encode(v)
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return err
+	}
+	return c.encryption.seal(w, buf.Bytes())
+}
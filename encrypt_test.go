@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryption(t *testing.T) {
+	k1 := bytes.Repeat([]byte{1}, 32)
+	k2 := bytes.Repeat([]byte{2}, 16)
+
+	c := NewClient(time.Minute, time.Minute, WithEncryption(map[string][]byte{"v1": k1}, "v1"))
+	defer c.StopGC()
+	c.Set("password", "hunter2", DefaultExpiration)
+
+	var items, dels bytes.Buffer
+	require.NoError(t, c.saveItem(&items))
+	require.NoError(t, c.saveDel(&dels))
+	require.False(t, bytes.Contains(items.Bytes(), []byte("hunter2")))
+	sealed := append([]byte(nil), items.Bytes()...)
+
+	// 轮换之后还能用旧的key加载旧文件
+	rotated := NewClient(time.Minute, time.Minute, WithEncryption(map[string][]byte{"v1": k1, "v2": k2}, "v2"))
+	defer rotated.StopGC()
+	require.NoError(t, rotated.load(bytes.NewReader(sealed), 1))
+	v, _ := rotated.Get("password")
+	require.Equal(t, "hunter2", v)
+	items.Reset()
+	require.NoError(t, rotated.saveItem(&items))
+	require.True(t, bytes.HasPrefix(items.Bytes(), encryptHeader("v2")))
+
+	// 缺少key、key错误、文件被修改、没有加密和没有配置加密都会失败
+	onlyV2 := NewClient(time.Minute, time.Minute, WithEncryption(map[string][]byte{"v2": k2}, "v2"))
+	defer onlyV2.StopGC()
+	require.Error(t, onlyV2.load(bytes.NewReader(sealed), 1))
+
+	wrong := NewClient(time.Minute, time.Minute, WithEncryption(map[string][]byte{"v1": k2}, "v1"))
+	defer wrong.StopGC()
+	require.Error(t, wrong.load(bytes.NewReader(sealed), 1))
+
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(tampered)-1] ^= 1
+	require.Error(t, c.load(bytes.NewReader(tampered), 1))
+
+	plain := NewClient(time.Minute, time.Minute)
+	defer plain.StopGC()
+	plain.Set("k", "v", DefaultExpiration)
+	var buf bytes.Buffer
+	require.NoError(t, plain.saveItem(&buf))
+	require.Error(t, c.load(&buf, 1))
+	require.Error(t, plain.load(bytes.NewReader(sealed), 1))
+
+	bad := NewClient(time.Minute, time.Minute, WithEncryption(map[string][]byte{"v1": []byte("short")}, "v1"))
+	defer bad.StopGC()
+	require.Error(t, bad.saveItem(&buf))
+}
@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBloomFilter(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	require.NoError(t, c.BFReserve("bf", 0.01, 1000, 2))
+	require.Error(t, c.BFReserve("bf", 0.01, 1000, 2))
+	for i := 0; i < 5000; i++ {
+		_, err := c.BFAdd("bf", strconv.Itoa(i))
+		require.NoError(t, err)
+	}
+	for i := 0; i < 5000; i++ {
+		ok, _ := c.BFExists("bf", strconv.Itoa(i))
+		require.True(t, ok)
+	}
+	info, _ := c.BFInfo("bf")
+	require.Equal(t, 3, info.Layers)
+	// 误判为已存在的元素不会计数
+	require.LessOrEqual(t, info.Items, uint64(5000))
+	require.Greater(t, info.Items, uint64(4800))
+
+	// 扩容之后总的误判率仍然接近设定值
+	fp := 0
+	for i := 5000; i < 15000; i++ {
+		if ok, _ := c.BFExists("bf", strconv.Itoa(i)); ok {
+			fp++
+		}
+	}
+	require.Less(t, fp, 300)
+
+	require.NoError(t, c.BFReserve("fixed", 0.01, 10, 0))
+	for i := 0; i < 10; i++ {
+		c.BFAdd("fixed", strconv.Itoa(i))
+	}
+	_, err := c.BFAdd("fixed", "overflow")
+	require.Error(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, c.saveItem(&buf))
+	c2 := NewClient(time.Minute, time.Minute)
+	defer c2.StopGC()
+	require.NoError(t, c2.load(&buf, 1))
+	ok, _ := c2.BFExists("bf", "4999")
+	require.True(t, ok)
+}
+
+func TestCuckooFilter(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	require.NoError(t, c.CFReserve("cf", 1000))
+	for i := 0; i < 900; i++ {
+		require.NoError(t, c.CFAdd("cf", strconv.Itoa(i)))
+	}
+	for i := 0; i < 900; i++ {
+		ok, _ := c.CFExists("cf", strconv.Itoa(i))
+		require.True(t, ok)
+	}
+
+	ok, _ := c.CFDel("cf", "1")
+	require.True(t, ok)
+	ok, _ = c.CFExists("cf", "1")
+	require.False(t, ok)
+	info, _ := c.CFInfo("cf")
+	require.Equal(t, uint64(899), info.Items)
+
+	// 满了之后加入失败，已有的元素不受影响
+	var err error
+	for i := 1000; err == nil; i++ {
+		err = c.CFAdd("cf", strconv.Itoa(i))
+	}
+	for i := 2; i < 900; i++ {
+		ok, _ := c.CFExists("cf", strconv.Itoa(i))
+		require.True(t, ok)
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, c.saveItem(&buf))
+	c2 := NewClient(time.Minute, time.Minute)
+	defer c2.StopGC()
+	require.NoError(t, c2.load(&buf, 1))
+	ok, _ = c2.CFExists("cf", "899")
+	require.True(t, ok)
+}
+
+func TestFilterCopyOnWrite(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	require.NoError(t, c.BFReserve("bf", 0.01, 10, 2))
+	for i := 0; i < 10; i++ {
+		_, err := c.BFAdd("bf", strconv.Itoa(i))
+		require.NoError(t, err)
+	}
+	require.NoError(t, c.CFAdd("cf", "a"))
+	s := c.Snapshot()
+	for i := 10; i < 30; i++ {
+		_, err := c.BFAdd("bf", strconv.Itoa(i))
+		require.NoError(t, err)
+	}
+	require.NoError(t, c.CFAdd("cf", "b"))
+	ok, err := c.CFDel("cf", "a")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// 快照里的过滤器不受之后的写入影响
+	v, _ := s.Get("bf")
+	info := v.(*BloomFilter).info()
+	require.Equal(t, 1, info.Layers)
+	require.Equal(t, uint64(10), info.Items)
+	v, _ = s.Get("cf")
+	cf := v.(*CuckooFilter)
+	require.True(t, cf.exists("a"))
+	require.Equal(t, uint64(1), cf.count)
+	bfInfo, _ := c.BFInfo("bf")
+	require.Greater(t, bfInfo.Layers, 1)
+
+	// 没有交出去的过滤器原地修改
+	first, firstCF := c.items["bf"].Object, c.items["cf"].Object
+	_, err = c.BFAdd("bf", "x")
+	require.NoError(t, err)
+	require.NoError(t, c.CFAdd("cf", "x"))
+	require.Same(t, first, c.items["bf"].Object)
+	require.Same(t, firstCF, c.items["cf"].Object)
+}
@@ -7,6 +7,13 @@ type garcoll struct {
 	stop     chan bool     // 停止回收的通道
 }
 
+// sweeper 内部有独立过期时间的value，比如哈希的field和信号量的许可，
+// gc时清理过期的部分。读者可能还持有原来的value，所以不能原地修改，
+// 需要返回清理之后的副本，没有需要清理的部分时返回nil，全部清理完时empty为true，整个key会被删除
+type sweeper interface {
+	sweep(now int64) (swept interface{}, empty bool)
+}
+
 func (gc *garcoll) Run(c *Cache) {
 	ticker := time.NewTicker(gc.interval)
 	for {
@@ -0,0 +1,318 @@
+package cache
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	geoStepMax     = 26             // 经纬度各用26位编码，合起来是52位，可以用float64的分数精确保存
+	geoLatMin      = -85.05112878   // 墨卡托投影能表示的最小纬度
+	geoLatMax      = 85.05112878    // 墨卡托投影能表示的最大纬度
+	geoLonMin      = -180.0         // 最小经度
+	geoLonMax      = 180.0          // 最大经度
+	geoEarthRadius = 6372797.560856 // 地球半径，单位米
+	geoMercatorMax = 20037726.37    // 墨卡托投影的最大距离，单位米
+)
+
+// GeoLocation 一个带有经纬度的成员
+type GeoLocation struct {
+	Member    string
+	Longitude float64
+	Latitude  float64
+}
+
+// GeoQuery GeoSearch的查询条件，Radius大于0时按半径查询，否则按Width和Height的矩形查询，
+// Member不为空时以这个成员的位置为中心，否则以Longitude和Latitude为中心
+type GeoQuery struct {
+	Member    string
+	Longitude float64
+	Latitude  float64
+	Radius    float64
+	Width     float64
+	Height    float64
+	Unit      string // 距离的单位，m、km、mi或者ft，为空时使用m
+	Count     int    // 最多返回的数量，小于等于0时不限制
+	Desc      bool   // 按距离从远到近排序
+}
+
+// GeoResult GeoSearch的一个结果，Dist的单位和查询条件一致
+type GeoResult struct {
+	Member    string
+	Longitude float64
+	Latitude  float64
+	Dist      float64
+}
+
+// geoUnit 返回距离单位对应的米数
+func geoUnit(unit string) (float64, error) {
+	switch unit {
+	case "", "m":
+		return 1, nil
+	case "km":
+		return 1000, nil
+	case "mi":
+		return 1609.34, nil
+	case "ft":
+		return 0.3048, nil
+	}
+	return 0, fmt.Errorf("unsupported unit %s", unit)
+}
+
+// geoCell 返回经纬度在step精度下所在格子的下标
+func geoCell(lon, lat float64, step uint) (uint64, uint64) {
+	n := float64(uint64(1) << step)
+	lonIdx := uint64((lon - geoLonMin) / (geoLonMax - geoLonMin) * n)
+	latIdx := uint64((lat - geoLatMin) / (geoLatMax - geoLatMin) * n)
+	if lonIdx >= uint64(n) {
+		lonIdx = uint64(n) - 1
+	}
+	if latIdx >= uint64(n) {
+		latIdx = uint64(n) - 1
+	}
+	return lonIdx, latIdx
+}
+
+// geoInterleave 把经度和纬度的下标交错成geohash，经度在高位
+func geoInterleave(lonIdx, latIdx uint64, step uint) uint64 {
+	var hash uint64
+	for i := int(step) - 1; i >= 0; i-- {
+		hash = hash<<2 | (lonIdx>>uint(i)&1)<<1 | latIdx>>uint(i)&1
+	}
+	return hash
+}
+
+// geoEncode 把经纬度编码成52位的geohash
+func geoEncode(lon, lat float64) uint64 {
+	lonIdx, latIdx := geoCell(lon, lat, geoStepMax)
+	return geoInterleave(lonIdx, latIdx, geoStepMax)
+}
+
+// geoDecode 把52位的geohash解码成格子中心的经纬度
+func geoDecode(hash uint64) (float64, float64) {
+	var lonIdx, latIdx uint64
+	for i := geoStepMax - 1; i >= 0; i-- {
+		lonIdx = lonIdx<<1 | hash>>uint(2*i+1)&1
+		latIdx = latIdx<<1 | hash>>uint(2*i)&1
+	}
+	n := float64(uint64(1) << geoStepMax)
+	lon := geoLonMin + (float64(lonIdx)+0.5)/n*(geoLonMax-geoLonMin)
+	lat := geoLatMin + (float64(latIdx)+0.5)/n*(geoLatMax-geoLatMin)
+	return lon, lat
+}
+
+// geoDistance 使用haversine公式计算两点之间的距离，单位米
+func geoDistance(lon1, lat1, lon2, lat2 float64) float64 {
+	lat1r, lat2r := lat1*math.Pi/180, lat2*math.Pi/180
+	u := math.Sin((lat2r - lat1r) / 2)
+	v := math.Sin((lon2 - lon1) * math.Pi / 180 / 2)
+	return 2 * geoEarthRadius * math.Asin(math.Sqrt(u*u+math.Cos(lat1r)*math.Cos(lat2r)*v*v))
+}
+
+// geoSteps 根据查询半径估计格子的精度，保证中心格子和周围8个格子能覆盖整个查询范围
+func geoSteps(radius, lat float64) uint {
+	if radius == 0 {
+		return geoStepMax
+	}
+	step := 1
+	for r := radius; r < geoMercatorMax; r *= 2 {
+		step++
+	}
+	step -= 2
+	if lat > 66 || lat < -66 {
+		step--
+	}
+	if lat > 80 || lat < -80 {
+		step--
+	}
+	if step < 1 {
+		step = 1
+	}
+	if step > geoStepMax {
+		step = geoStepMax
+	}
+	return uint(step)
+}
+
+// geoCellSize 返回step精度下格子在纬度lat处的宽和高，单位米
+func geoCellSize(step uint, lat float64) (float64, float64) {
+	n := float64(uint64(1) << step)
+	height := (geoLatMax - geoLatMin) / n * math.Pi / 180 * geoEarthRadius
+	width := (geoLonMax - geoLonMin) / n * math.Pi / 180 * geoEarthRadius * math.Cos(lat*math.Pi/180)
+	return width, height
+}
+
+// geoValid 判断经纬度是否在可以编码的范围内
+func geoValid(lon, lat float64) bool {
+	return lon >= geoLonMin && lon <= geoLonMax && lat >= geoLatMin && lat <= geoLatMax
+}
+
+// GeoAdd 向地理位置集合中加入成员或者更新成员的位置，返回新加入的数量，
+// 地理位置集合是一个以geohash为分数的有序集合，key不存在时使用默认过期时间新建
+func (c *Cache) GeoAdd(k string, locations ...GeoLocation) (int, error) {
+	for _, l := range locations {
+		if !geoValid(l.Longitude, l.Latitude) {
+			return 0, fmt.Errorf("invalid longitude,latitude pair %f,%f", l.Longitude, l.Latitude)
+		}
+	}
+	if len(locations) == 0 {
+		return 0, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	z, existed, err := c.mutableZSet(k, true)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, l := range locations {
+		if z.add(l.Member, float64(geoEncode(l.Longitude, l.Latitude))) {
+			n++
+		}
+	}
+	c.putZSet(k, z, existed)
+	return n, nil
+}
+
+// GeoPos 返回成员的经纬度，不存在的成员对应的位置为nil
+func (c *Cache) GeoPos(k string, members ...string) ([]*GeoLocation, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	z, _, err := c.getZSet(k)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*GeoLocation, len(members))
+	for i, m := range members {
+		if z == nil {
+			continue
+		}
+		if score, ok := z.dict[m]; ok {
+			lon, lat := geoDecode(uint64(score))
+			res[i] = &GeoLocation{Member: m, Longitude: lon, Latitude: lat}
+		}
+	}
+	return res, nil
+}
+
+// GeoDist 返回两个成员之间的距离，有成员不存在时返回false
+func (c *Cache) GeoDist(k, member1, member2, unit string) (float64, bool, error) {
+	u, err := geoUnit(unit)
+	if err != nil {
+		return 0, false, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	z, ok, err := c.getZSet(k)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	s1, ok1 := z.dict[member1]
+	s2, ok2 := z.dict[member2]
+	if !ok1 || !ok2 {
+		return 0, false, nil
+	}
+	lon1, lat1 := geoDecode(uint64(s1))
+	lon2, lat2 := geoDecode(uint64(s2))
+	return geoDistance(lon1, lat1, lon2, lat2) / u, true, nil
+}
+
+// GeoSearch 查询在圆形或者矩形范围内的成员，按距离排序，
+// 只扫描中心格子和周围8个格子在有序集合中对应的分数区间
+func (c *Cache) GeoSearch(k string, q GeoQuery) ([]GeoResult, error) {
+	u, err := geoUnit(q.Unit)
+	if err != nil {
+		return nil, err
+	}
+	if q.Radius <= 0 && (q.Width <= 0 || q.Height <= 0) {
+		return nil, fmt.Errorf("either radius or width and height must be positive")
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	z, ok, err := c.getZSet(k)
+	if err != nil || !ok {
+		return []GeoResult{}, err
+	}
+
+	lon, lat := q.Longitude, q.Latitude
+	if q.Member != "" {
+		score, ok := z.dict[q.Member]
+		if !ok {
+			return nil, fmt.Errorf("member %s not found", q.Member)
+		}
+		lon, lat = geoDecode(uint64(score))
+	} else if !geoValid(lon, lat) {
+		return nil, fmt.Errorf("invalid longitude,latitude pair %f,%f", lon, lat)
+	}
+
+	// 矩形查询使用外接圆的半径估计格子大小
+	radius := q.Radius * u
+	width, height := q.Width*u, q.Height*u
+	if q.Radius <= 0 {
+		radius = math.Sqrt(width*width+height*height) / 2
+	}
+
+	// 格子的宽和高都不能小于查询半径，纬度越高格子越窄，用离赤道最远的边界计算宽度
+	step := geoSteps(radius, lat)
+	edge := math.Min(math.Abs(lat)+radius/geoEarthRadius*180/math.Pi, geoLatMax)
+	for step > 1 {
+		w, h := geoCellSize(step, edge)
+		if w >= radius && h >= radius {
+			break
+		}
+		step--
+	}
+
+	n := uint64(1) << step
+	lonIdx, latIdx := geoCell(lon, lat, step)
+	shift := 2 * (geoStepMax - step)
+	seen := make(map[uint64]bool)
+	res := make([]GeoResult, 0)
+	for dLat := -1; dLat <= 1; dLat++ {
+		li := int64(latIdx) + int64(dLat)
+		if li < 0 || li >= int64(n) {
+			continue
+		}
+		for dLon := -1; dLon <= 1; dLon++ {
+			lo := (lonIdx + n + uint64(dLon)) % n
+			cell := geoInterleave(lo, uint64(li), step)
+			if seen[cell] {
+				continue
+			}
+			seen[cell] = true
+
+			min, max := float64(cell<<shift), float64((cell+1)<<shift-1)
+			for _, m := range z.rangeByScore(min, max, 0, -1, false) {
+				mlon, mlat := geoDecode(uint64(m.Score))
+				dist := geoDistance(lon, lat, mlon, mlat)
+				if q.Radius > 0 {
+					if dist > radius {
+						continue
+					}
+				} else if geoDistance(lon, lat, lon, mlat) > height/2 || geoDistance(lon, mlat, mlon, mlat) > width/2 {
+					continue
+				}
+				res = append(res, GeoResult{Member: m.Member, Longitude: mlon, Latitude: mlat, Dist: dist / u})
+			}
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if q.Desc {
+			return res[i].Dist > res[j].Dist
+		}
+		return res[i].Dist < res[j].Dist
+	})
+	if q.Count > 0 && len(res) > q.Count {
+		res = res[:q.Count]
+	}
+	return res, nil
+}
@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeo(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	n, err := c.GeoAdd("sicily",
+		GeoLocation{"Palermo", 13.361389, 38.115556},
+		GeoLocation{"Catania", 15.087269, 37.502669})
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	d, ok, err := c.GeoDist("sicily", "Palermo", "Catania", "km")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.InDelta(t, 166.274, d, 0.01)
+
+	pos, _ := c.GeoPos("sicily", "Palermo", "Rome")
+	require.InDelta(t, 13.361389, pos[0].Longitude, 1e-5)
+	require.InDelta(t, 38.115556, pos[0].Latitude, 1e-5)
+	require.Nil(t, pos[1])
+
+	res, err := c.GeoSearch("sicily", GeoQuery{Longitude: 15, Latitude: 37, Radius: 100, Unit: "km"})
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	require.Equal(t, "Catania", res[0].Member)
+	require.InDelta(t, 56.4413, res[0].Dist, 0.01)
+
+	res, _ = c.GeoSearch("sicily", GeoQuery{Longitude: 15, Latitude: 37, Radius: 200, Unit: "km", Desc: true})
+	require.Len(t, res, 2)
+	require.Equal(t, "Palermo", res[0].Member)
+
+	res, _ = c.GeoSearch("sicily", GeoQuery{Member: "Palermo", Width: 400, Height: 400, Unit: "km", Count: 1})
+	require.Len(t, res, 1)
+	require.Equal(t, "Palermo", res[0].Member)
+	require.Equal(t, float64(0), res[0].Dist)
+}
+
+// TestGeoSearchCoverage 和暴力计算的结果对比，保证格子覆盖了整个查询范围
+func TestGeoSearchCoverage(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	points := make([]GeoLocation, 2000)
+	for i := range points {
+		points[i] = GeoLocation{
+			Member:    strconv.Itoa(i),
+			Longitude: 116 + rand.Float64(),
+			Latitude:  39 + rand.Float64(),
+		}
+	}
+	c.GeoAdd("drivers", points...)
+	members := make([]string, len(points))
+	for i, p := range points {
+		members[i] = p.Member
+	}
+	pos, _ := c.GeoPos("drivers", members...)
+
+	for _, radius := range []float64{100, 2000, 20000} {
+		res, err := c.GeoSearch("drivers", GeoQuery{Longitude: 116.5, Latitude: 39.5, Radius: radius})
+		require.NoError(t, err)
+
+		expected := make([]string, 0)
+		for _, p := range pos {
+			if geoDistance(116.5, 39.5, p.Longitude, p.Latitude) <= radius {
+				expected = append(expected, p.Member)
+			}
+		}
+		actual := make([]string, 0, len(res))
+		for i, r := range res {
+			actual = append(actual, r.Member)
+			if i > 0 {
+				require.False(t, r.Dist < res[i-1].Dist || math.IsNaN(r.Dist))
+			}
+		}
+		sort.Strings(expected)
+		sort.Strings(actual)
+		require.Equal(t, expected, actual)
+	}
+}
+
+func TestGeoCopyOnWrite(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	n, err := c.GeoAdd("empty")
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+	require.False(t, c.IsExistedKey("empty"))
+	require.False(t, c.SearchDel("empty"))
+
+	_, err = c.GeoAdd("sicily", GeoLocation{"Palermo", 13.361389, 38.115556})
+	require.NoError(t, err)
+	s := c.Snapshot()
+	_, err = c.GeoAdd("sicily",
+		GeoLocation{"Catania", 15.087269, 37.502669},
+		GeoLocation{"Palermo", 13.5, 38.2})
+	require.NoError(t, err)
+
+	// 快照里的地理位置集合不受之后的写入影响
+	v, _ := s.Get("sicily")
+	z := v.(*SortedSet)
+	require.Equal(t, 1, z.card())
+	require.Equal(t, float64(geoEncode(13.361389, 38.115556)), z.dict["Palermo"])
+	pos, err := c.GeoPos("sicily", "Palermo", "Catania")
+	require.NoError(t, err)
+	require.InDelta(t, 13.5, pos[0].Longitude, 1e-5)
+	require.NotNil(t, pos[1])
+}
@@ -0,0 +1,286 @@
+package cache
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Hash 哈希类型的value，每个field可以单独设置过期时间
+type Hash struct {
+	Fields  map[string]interface{} // field -> value
+	Expires map[string]int64       // 设置了过期时间的field -> 过期时间
+}
+
+func newHash() Hash {
+	return Hash{
+		Fields:  make(map[string]interface{}),
+		Expires: make(map[string]int64),
+	}
+}
+
+// has 判断field是否存在且未过期
+func (h Hash) has(field string, now int64) bool {
+	if _, ok := h.Fields[field]; !ok {
+		return false
+	}
+	e, ok := h.Expires[field]
+	return !ok || now <= e
+}
+
+// clone 复制哈希，修改之前必须复制，Get和Snapshot返回的哈希可能还在被读取
+func (h Hash) clone() Hash {
+	n := Hash{
+		Fields:  make(map[string]interface{}, len(h.Fields)),
+		Expires: make(map[string]int64, len(h.Expires)),
+	}
+	for f, v := range h.Fields {
+		n.Fields[f] = v
+	}
+	for f, e := range h.Expires {
+		n.Expires[f] = e
+	}
+	return n
+}
+
+// prune 原地删除所有过期的field，只能用于复制出来的哈希
+func (h Hash) prune(now int64) {
+	for f, e := range h.Expires {
+		if now > e {
+			delete(h.Fields, f)
+			delete(h.Expires, f)
+		}
+	}
+}
+
+// sweep 返回删除过期field之后的副本，没有过期的field时返回nil
+func (h Hash) sweep(now int64) (interface{}, bool) {
+	for _, e := range h.Expires {
+		if now > e {
+			n := h.clone()
+			n.prune(now)
+			return n, len(n.Fields) == 0
+		}
+	}
+	return nil, len(h.Fields) == 0
+}
+
+// getHash 获取key对应的哈希，key不存在或者已经过期时返回false，外部加锁
+func (c *Cache) getHash(k string) (Hash, bool, error) {
+	item, ok := c.lookup(k)
+	if !ok {
+		return Hash{}, false, nil
+	}
+	h, ok := item.Object.(Hash)
+	if !ok {
+		return Hash{}, false, fmt.Errorf("the value for %s is not a hash", k)
+	}
+	return h, true, nil
+}
+
+// mutableHash 获取key对应的哈希的副本用于修改，会先清理过期的field，
+// create为true时key不存在会使用默认过期时间新建，修改之后用putHash写回，外部加写锁
+func (c *Cache) mutableHash(k string, create bool) (Hash, bool, error) {
+	h, ok, err := c.getHash(k)
+	if err != nil {
+		return Hash{}, false, err
+	}
+	if !ok {
+		if !create {
+			return Hash{}, false, nil
+		}
+		h = newHash()
+		c.add(k, h, DefaultExpiration)
+		return h, true, nil
+	}
+	// 复制出来的哈希总是有初始化的map，gob不会编码空的map，Load之后也不会是nil
+	h = h.clone()
+	h.prune(time.Now().UnixNano())
+	return h, true, nil
+}
+
+// putHash 修改完成之后同步索引，哈希为空时删除这个key，外部加写锁
+func (c *Cache) putHash(k string, h Hash) {
+	if len(h.Fields) == 0 {
+		c.manualDelete(k)
+		return
+	}
+	c.update(k, h)
+}
+
+// HSet 设置哈希中field的值，会清除field原来的过期时间，
+// 新建field时返回true，key不存在时使用默认过期时间新建一个哈希
+func (c *Cache) HSet(k, field string, value interface{}) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	h, _, err := c.mutableHash(k, true)
+	if err != nil {
+		return false, err
+	}
+	_, existed := h.Fields[field]
+	h.Fields[field] = value
+	delete(h.Expires, field)
+	c.putHash(k, h)
+	return !existed, nil
+}
+
+// HExpire 为哈希中的field单独设置过期时间，d小于等于0时清除过期时间，
+// field不存在时返回false
+func (c *Cache) HExpire(k, field string, d time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	h, ok, err := c.mutableHash(k, false)
+	if err != nil || !ok {
+		return false, err
+	}
+	if _, ok := h.Fields[field]; !ok {
+		return false, nil
+	}
+	if d > 0 {
+		h.Expires[field] = time.Now().Add(d).UnixNano()
+	} else {
+		delete(h.Expires, field)
+	}
+	c.putHash(k, h)
+	return true, nil
+}
+
+// HGet 获取哈希中field的值，field不存在或者已经过期时返回false
+func (c *Cache) HGet(k, field string) (interface{}, bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	h, ok, err := c.getHash(k)
+	if err != nil || !ok || !h.has(field, time.Now().UnixNano()) {
+		return nil, false, err
+	}
+	return h.Fields[field], true, nil
+}
+
+// HDel 删除哈希中的field，返回删除的数量，哈希为空时删除这个key
+func (c *Cache) HDel(k string, fields ...string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	h, ok, err := c.mutableHash(k, false)
+	if err != nil || !ok {
+		return 0, err
+	}
+	n := 0
+	for _, f := range fields {
+		if _, ok := h.Fields[f]; ok {
+			delete(h.Fields, f)
+			delete(h.Expires, f)
+			n++
+		}
+	}
+	c.putHash(k, h)
+	return n, nil
+}
+
+// HGetAll 复制哈希中所有未过期的field
+func (c *Cache) HGetAll(k string) (map[string]interface{}, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	h, _, err := c.getHash(k)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixNano()
+	m := make(map[string]interface{}, len(h.Fields))
+	for f, v := range h.Fields {
+		if h.has(f, now) {
+			m[f] = v
+		}
+	}
+	return m, nil
+}
+
+// HExists 判断哈希中是否存在未过期的field
+func (c *Cache) HExists(k, field string) (bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	h, ok, err := c.getHash(k)
+	if err != nil || !ok {
+		return false, err
+	}
+	return h.has(field, time.Now().UnixNano()), nil
+}
+
+// HLen 返回哈希中未过期的field数量，key不存在时返回0
+func (c *Cache) HLen(k string) (int, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	h, _, err := c.getHash(k)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().UnixNano()
+	n := 0
+	for f := range h.Fields {
+		if h.has(f, now) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// HKeys 按字典序返回哈希中所有未过期的field
+func (c *Cache) HKeys(k string) ([]string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	h, _, err := c.getHash(k)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixNano()
+	keys := make([]string, 0, len(h.Fields))
+	for f := range h.Fields {
+		if h.has(f, now) {
+			keys = append(keys, f)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// HIncrBy 为哈希中的field增加n，field不存在时从0开始，
+// field原来的值必须是有符号整数，结果以int64保存
+func (c *Cache) HIncrBy(k, field string, n int64) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	h, _, err := c.mutableHash(k, true)
+	if err != nil {
+		return 0, err
+	}
+
+	var cur int64
+	if v, ok := h.Fields[field]; ok {
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			cur = rv.Int()
+		default:
+			return 0, fmt.Errorf("the value for field %s can not be increased", field)
+		}
+	}
+	// 和Increment一样，超出int64范围时返回错误，不回绕
+	switch {
+	case n > 0 && cur > math.MaxInt64-n:
+		return 0, fmt.Errorf("int64 overflow")
+	case n < 0 && cur < math.MinInt64-n:
+		return 0, fmt.Errorf("int64 underflow")
+	}
+	h.Fields[field] = cur + n
+	c.putHash(k, h)
+	return cur + n, nil
+}
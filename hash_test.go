@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHash(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	created, err := c.HSet("h", "a", 1)
+	require.NoError(t, err)
+	require.True(t, created)
+	created, err = c.HSet("h", "a", 2)
+	require.NoError(t, err)
+	require.False(t, created)
+	_, err = c.HSet("h", "b", "x")
+	require.NoError(t, err)
+
+	v, ok, err := c.HGet("h", "a")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 2, v)
+	keys, err := c.HKeys("h")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, keys)
+
+	// field单独过期
+	ok, err = c.HExpire("h", "b", time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = c.HExpire("h", "missing", time.Minute)
+	require.NoError(t, err)
+	require.False(t, ok)
+	time.Sleep(2 * time.Millisecond)
+	_, ok, _ = c.HGet("h", "b")
+	require.False(t, ok)
+	n, err := c.HLen("h")
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	all, err := c.HGetAll("h")
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"a": 2}, all)
+
+	// 重新设置会清除过期时间
+	_, err = c.HSet("h", "b", "y")
+	require.NoError(t, err)
+	exists, err := c.HExists("h", "b")
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	// HIncrBy只支持有符号整数
+	got, err := c.HIncrBy("h", "a", 3)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), got)
+	got, err = c.HIncrBy("h", "new", -2)
+	require.NoError(t, err)
+	require.Equal(t, int64(-2), got)
+	_, err = c.HIncrBy("h", "b", 1)
+	require.Error(t, err)
+	// 超出int64范围时返回错误，原来的值不变
+	_, err = c.HIncrBy("h", "a", math.MaxInt64)
+	require.Error(t, err)
+	_, err = c.HIncrBy("h", "new", math.MinInt64)
+	require.Error(t, err)
+	got, err = c.HIncrBy("h", "a", 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), got)
+	got, err = c.HIncrBy("h", "new", 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(-2), got)
+	c.Set("str", "v", DefaultExpiration)
+	_, err = c.HSet("str", "a", 1)
+	require.Error(t, err)
+	_, err = c.HIncrBy("str", "a", 1)
+	require.Error(t, err)
+
+	// 持久化之后过期时间也能恢复
+	_, err = c.HExpire("h", "b", time.Minute)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, c.saveItem(&buf))
+	c2 := NewClient(time.Minute, time.Minute)
+	defer c2.StopGC()
+	require.NoError(t, c2.load(&buf, 1))
+	all, err = c2.HGetAll("h")
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"a": int64(5), "b": "y", "new": int64(-2)}, all)
+	ok, err = c2.HExpire("h", "a", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// 删除最后一个field时删除整个key
+	n, err = c.HDel("h", "a", "b", "new", "missing")
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	require.False(t, c.IsExistedKey("h"))
+	require.True(t, c.SearchDel("h"))
+
+	// 最后一个field过期之后gc删除整个key
+	_, err = c.HSet("g", "a", 1)
+	require.NoError(t, err)
+	_, err = c.HExpire("g", "a", time.Millisecond)
+	require.NoError(t, err)
+	time.Sleep(2 * time.Millisecond)
+	c.delete()
+	require.False(t, c.IsExistedKey("g"))
+}
+
+func TestHashCopyOnWrite(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	_, err := c.HSet("h", "a", 1)
+	require.NoError(t, err)
+	_, err = c.HSet("h", "b", 2)
+	require.NoError(t, err)
+	_, err = c.HExpire("h", "b", time.Millisecond)
+	require.NoError(t, err)
+	v, _ := c.Get("h")
+	held := v.(Hash)
+
+	// 持有Get返回的哈希的同时并发写入，-race下不能有数据竞争
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				f := strconv.Itoa(i*100 + j)
+				_, _ = c.HSet("h", f, j)
+				_, _ = c.HIncrBy("h", "n", 1)
+				_, _ = c.HDel("h", f)
+			}
+		}(i)
+	}
+	for j := 0; j < 100; j++ {
+		_ = len(held.Fields)
+		_ = held.Fields["a"]
+	}
+	wg.Wait()
+
+	time.Sleep(2 * time.Millisecond)
+	c.delete()
+	require.Equal(t, map[string]interface{}{"a": 1, "b": 2}, held.Fields)
+	all, err := c.HGetAll("h")
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"a": 1, "n": int64(400)}, all)
+}
@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const hotKeyRateWindow = float64(time.Minute) // 访问速率的指数衰减时间常数
+
+// HotKey 一个热点key的统计
+type HotKey struct {
+	Key   string
+	Count uint64  // 估计的访问次数，不会小于真实值
+	Error uint64  // 估计的最大误差，真实值不小于Count-Error
+	Rate  float64 // 最近大约一分钟内平均每秒的访问次数
+}
+
+// hotKeyEntry Space-Saving算法中被跟踪的一个key
+type hotKeyEntry struct {
+	key   string
+	count uint64
+	err   uint64
+	rate  float64 // 指数衰减的访问速率，单位是每秒
+	last  int64   // 最后一次访问的时间
+	index int     // 在堆中的下标
+}
+
+// decayedRate 返回衰减到now时的访问速率
+func (e *hotKeyEntry) decayedRate(now int64) float64 {
+	return e.rate * math.Exp(-float64(now-e.last)/hotKeyRateWindow)
+}
+
+// hotKeyHeap 按访问次数排序的小顶堆，堆顶是被替换的候选
+type hotKeyHeap []*hotKeyEntry
+
+func (h hotKeyHeap) Len() int           { return len(h) }
+func (h hotKeyHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h hotKeyHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *hotKeyHeap) Push(x interface{}) {
+	e := x.(*hotKeyEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+func (h *hotKeyHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// hotKeyTracker 使用Space-Saving算法在固定的空间内统计访问最多的key，
+// 读操作只持有cache的读锁，所以需要自己的锁
+type hotKeyTracker struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*hotKeyEntry
+	heap     hotKeyHeap
+}
+
+func newHotKeyTracker(capacity int) *hotKeyTracker {
+	return &hotKeyTracker{
+		capacity: capacity,
+		entries:  make(map[string]*hotKeyEntry, capacity),
+		heap:     make(hotKeyHeap, 0, capacity),
+	}
+}
+
+// touch 记录一次访问，没有位置时替换访问次数最少的key，新key继承它的次数作为误差
+func (t *hotKeyTracker) touch(k string) {
+	now := time.Now().UnixNano()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, ok := t.entries[k]
+	switch {
+	case ok:
+		e.count++
+		e.rate = e.decayedRate(now)
+		heap.Fix(&t.heap, e.index)
+	case len(t.heap) < t.capacity:
+		e = &hotKeyEntry{key: k, count: 1, last: now}
+		t.entries[k] = e
+		heap.Push(&t.heap, e)
+	default:
+		e = t.heap[0]
+		delete(t.entries, e.key)
+		*e = hotKeyEntry{key: k, count: e.count + 1, err: e.count, last: now, index: 0}
+		t.entries[k] = e
+		heap.Fix(&t.heap, 0)
+	}
+	e.rate += float64(time.Second) / hotKeyRateWindow
+	e.last = now
+}
+
+// top 返回访问次数最多的n个key
+func (t *hotKeyTracker) top(n int) []HotKey {
+	now := time.Now().UnixNano()
+
+	t.mu.Lock()
+	res := make([]HotKey, 0, len(t.heap))
+	for _, e := range t.heap {
+		res = append(res, HotKey{Key: e.key, Count: e.count, Error: e.err, Rate: e.decayedRate(now)})
+	}
+	t.mu.Unlock()
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Count != res[j].Count {
+			return res[i].Count > res[j].Count
+		}
+		return res[i].Key < res[j].Key
+	})
+	if n >= 0 && len(res) > n {
+		res = res[:n]
+	}
+	return res
+}
+
+// touchHotKey 如果开启了热点统计就记录一次访问，关闭时只有一次原子读的开销
+func (c *Cache) touchHotKey(k string) {
+	if t, _ := c.hotKeys.Load().(*hotKeyTracker); t != nil {
+		t.touch(k)
+	}
+}
+
+// EnableHotKeys 开启热点key统计，最多同时跟踪capacity个key，Get和Set都会计入访问次数，
+// 重复开启会清空之前的统计
+func (c *Cache) EnableHotKeys(capacity int) {
+	if capacity <= 0 {
+		capacity = defaultHotKeyCapacity
+	}
+	c.hotKeys.Store(newHotKeyTracker(capacity))
+}
+
+// DisableHotKeys 关闭热点key统计并清空统计数据
+func (c *Cache) DisableHotKeys() {
+	c.hotKeys.Store((*hotKeyTracker)(nil))
+}
+
+// HotKeys 返回访问次数最多的n个key，n小于0时返回所有被跟踪的key，没有开启统计时返回nil
+func (c *Cache) HotKeys(n int) []HotKey {
+	t, _ := c.hotKeys.Load().(*hotKeyTracker)
+	if t == nil {
+		return nil
+	}
+	return t.top(n)
+}
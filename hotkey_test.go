@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHotKeys(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	// 没有开启时不统计
+	c.Set("a", 1, DefaultExpiration)
+	c.Get("a")
+	require.Nil(t, c.HotKeys(10))
+
+	c.EnableHotKeys(10)
+	for i := 0; i < 1000; i++ {
+		c.Set("k"+strconv.Itoa(i), i, DefaultExpiration)
+	}
+
+	// 少量热点key夹在大量冷key中，并发访问
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				c.Get("k1")
+				c.Get("k2")
+				if i%2 == 0 {
+					c.Get("k3")
+				}
+				c.Get("k" + strconv.Itoa(100+i%900))
+			}
+		}()
+	}
+	wg.Wait()
+
+	hot := c.HotKeys(3)
+	require.Len(t, hot, 3)
+	require.ElementsMatch(t, []string{"k1", "k2"}, []string{hot[0].Key, hot[1].Key})
+	require.Equal(t, "k3", hot[2].Key)
+	require.GreaterOrEqual(t, hot[0].Count, uint64(4000))
+	require.GreaterOrEqual(t, hot[2].Count, uint64(2000))
+	require.Greater(t, hot[0].Rate, 0.0)
+	require.Len(t, c.HotKeys(-1), 10)
+
+	c.DisableHotKeys()
+	require.Nil(t, c.HotKeys(3))
+}
@@ -0,0 +1,295 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+const (
+	hllP              = 14        // 用哈希值的高14位选择寄存器
+	hllRegisters      = 1 << hllP // 寄存器的数量
+	hllQ              = 64 - hllP // 剩下用来计算前导零的位数
+	hllSparseMaxItems = 2048      // 稀疏表示最多保存的寄存器数量，超过之后转为稠密表示
+)
+
+// HyperLogLog 基数估计类型的value，使用16384个寄存器，标准误差约为1.04/sqrt(16384)=0.81%，
+// 寄存器较少时使用稀疏表示，每个非零寄存器占4个字节，超过hllSparseMaxItems后转为每个寄存器1个字节的稠密表示。
+// 寄存器不导出，Get和Snapshot返回的HyperLogLog只能用来判断类型，
+// 交出去之后第一次写入时会复制一份，之后没有再交出去就原地修改
+type HyperLogLog struct {
+	sparse []uint32 // 稀疏表示，按寄存器下标排序，每一项是 下标<<8 | 值
+	dense  []byte   // 稠密表示，为nil时使用稀疏表示
+}
+
+// hllState 持久化时使用的寄存器
+type hllState struct {
+	Sparse []uint32
+	Dense  []byte
+}
+
+// GobEncode 持久化寄存器
+func (hll *HyperLogLog) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(hllState{Sparse: hll.sparse, Dense: hll.dense}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode 恢复持久化的寄存器
+func (hll *HyperLogLog) GobDecode(data []byte) error {
+	var st hllState
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&st); err != nil {
+		return err
+	}
+	hll.sparse, hll.dense = st.Sparse, st.Dense
+	return nil
+}
+
+// clone 复制寄存器，修改交出去过的HyperLogLog之前必须复制
+func (hll *HyperLogLog) clone() *HyperLogLog {
+	n := &HyperLogLog{}
+	if hll.dense != nil {
+		n.dense = append([]byte(nil), hll.dense...)
+	} else {
+		n.sparse = append([]uint32(nil), hll.sparse...)
+	}
+	return n
+}
+
+// hllPosition 返回元素对应的寄存器下标和前导零的数量加一
+func hllPosition(element string) (uint32, uint8) {
+	h := hash64(element)
+	idx := uint32(h >> hllQ)
+	w := h<<hllP | 1<<(hllP-1)
+	return idx, uint8(bits.LeadingZeros64(w) + 1)
+}
+
+// set 更新一个寄存器，值变大时返回true
+func (hll *HyperLogLog) set(idx uint32, val uint8) bool {
+	if hll.dense != nil {
+		if hll.dense[idx] >= val {
+			return false
+		}
+		hll.dense[idx] = val
+		return true
+	}
+
+	i := sort.Search(len(hll.sparse), func(i int) bool { return hll.sparse[i]>>8 >= idx })
+	if i < len(hll.sparse) && hll.sparse[i]>>8 == idx {
+		if uint8(hll.sparse[i]) >= val {
+			return false
+		}
+		hll.sparse[i] = idx<<8 | uint32(val)
+		return true
+	}
+	hll.sparse = append(hll.sparse, 0)
+	copy(hll.sparse[i+1:], hll.sparse[i:])
+	hll.sparse[i] = idx<<8 | uint32(val)
+	if len(hll.sparse) > hllSparseMaxItems {
+		hll.toDense()
+	}
+	return true
+}
+
+// toDense 从稀疏表示转为稠密表示
+func (hll *HyperLogLog) toDense() {
+	if hll.dense != nil {
+		return
+	}
+	hll.dense = make([]byte, hllRegisters)
+	for _, e := range hll.sparse {
+		hll.dense[e>>8] = uint8(e)
+	}
+	hll.sparse = nil
+}
+
+// add 加入一个元素，估计值可能发生变化时返回true
+func (hll *HyperLogLog) add(element string) bool {
+	return hll.set(hllPosition(element))
+}
+
+// merge 把other合并进来，每个寄存器取较大的值
+func (hll *HyperLogLog) merge(other *HyperLogLog) {
+	if other.dense == nil {
+		for _, e := range other.sparse {
+			hll.set(e>>8, uint8(e))
+		}
+		return
+	}
+	hll.toDense()
+	for i, v := range other.dense {
+		if v > hll.dense[i] {
+			hll.dense[i] = v
+		}
+	}
+}
+
+// histogram 统计每个寄存器值出现的次数
+func (hll *HyperLogLog) histogram() [hllQ + 2]int {
+	var h [hllQ + 2]int
+	if hll.dense != nil {
+		for _, v := range hll.dense {
+			h[v]++
+		}
+		return h
+	}
+	h[0] = hllRegisters - len(hll.sparse)
+	for _, e := range hll.sparse {
+		h[uint8(e)]++
+	}
+	return h
+}
+
+// count 使用Ertl提出的改进估计算法计算基数，不需要偏差修正表，在小基数和大基数下都适用
+func (hll *HyperLogLog) count() uint64 {
+	h := hll.histogram()
+	m := float64(hllRegisters)
+
+	z := m * hllTau((m-float64(h[hllQ+1]))/m)
+	for k := hllQ; k >= 1; k-- {
+		z += float64(h[k])
+		z *= 0.5
+	}
+	z += m * hllSigma(float64(h[0])/m)
+	return uint64(math.Round(0.5 / math.Ln2 * m * m / z))
+}
+
+func hllSigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y, z := 1.0, x
+	for {
+		x *= x
+		prev := z
+		z += x * y
+		y += y
+		if prev == z {
+			return z
+		}
+	}
+}
+
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y, z := 1.0, 1-x
+	for {
+		x = math.Sqrt(x)
+		prev := z
+		y *= 0.5
+		z -= (1 - x) * (1 - x) * y
+		if prev == z {
+			return z / 3
+		}
+	}
+}
+
+// getHLL 获取key对应的HyperLogLog，key不存在或者已经过期时返回false，外部加锁
+func (c *Cache) getHLL(k string) (*HyperLogLog, bool, error) {
+	item, ok := c.lookup(k)
+	if !ok {
+		return nil, false, nil
+	}
+	hll, ok := item.Object.(*HyperLogLog)
+	if !ok {
+		return nil, false, fmt.Errorf("the value for %s is not a hyperloglog", k)
+	}
+	return hll, true, nil
+}
+
+// PFAdd 向HyperLogLog中加入元素，估计值可能发生变化时返回true，
+// key不存在时使用默认过期时间新建
+func (c *Cache) PFAdd(k string, elements ...string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	hll, ok, err := c.getHLL(k)
+	if err != nil {
+		return false, err
+	}
+	changed := !ok
+	if !ok {
+		hll = &HyperLogLog{}
+		c.add(k, hll, DefaultExpiration)
+	} else if !c.owns(k) {
+		hll = hll.clone()
+	}
+	for _, e := range elements {
+		if hll.add(e) {
+			changed = true
+		}
+	}
+	c.update(k, hll)
+	c.own(k)
+	return changed, nil
+}
+
+// PFCount 返回HyperLogLog的基数估计值，传入多个key时返回它们并集的估计值
+func (c *Cache) PFCount(keys ...string) (uint64, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if len(keys) == 1 {
+		hll, ok, err := c.getHLL(keys[0])
+		if err != nil || !ok {
+			return 0, err
+		}
+		return hll.count(), nil
+	}
+
+	union := &HyperLogLog{}
+	for _, k := range keys {
+		hll, ok, err := c.getHLL(k)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			union.merge(hll)
+		}
+	}
+	return union.count(), nil
+}
+
+// PFMerge 把多个HyperLogLog合并到dest，dest原来的数据也会保留，
+// dest不存在时使用默认过期时间新建
+func (c *Cache) PFMerge(dest string, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	srcs := make([]*HyperLogLog, 0, len(keys))
+	for _, k := range keys {
+		hll, ok, err := c.getHLL(k)
+		if err != nil {
+			return err
+		}
+		if ok {
+			srcs = append(srcs, hll)
+		}
+	}
+
+	d, ok, err := c.getHLL(dest)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		d = &HyperLogLog{}
+		c.add(dest, d, DefaultExpiration)
+	} else if !c.owns(dest) {
+		d = d.clone()
+	}
+	for _, hll := range srcs {
+		if hll != d {
+			d.merge(hll)
+		}
+	}
+	c.update(dest, d)
+	c.own(dest)
+	return nil
+}
@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// requireClose 估计值和真实值的误差不超过标准误差的4倍
+func requireClose(t *testing.T, expected int, actual uint64) {
+	diff := math.Abs(float64(actual)-float64(expected)) / float64(expected)
+	require.LessOrEqual(t, diff, 4*1.04/math.Sqrt(hllRegisters), "expected %d, got %d", expected, actual)
+}
+
+func TestHyperLogLog(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	for i := 0; i < 100; i++ {
+		c.PFAdd("small", strconv.Itoa(i))
+	}
+	n, err := c.PFCount("small")
+	require.NoError(t, err)
+	require.Equal(t, uint64(100), n)
+
+	for i := 0; i < 100000; i++ {
+		c.PFAdd("a", strconv.Itoa(i))
+		c.PFAdd("b", strconv.Itoa(i+50000))
+	}
+	n, _ = c.PFCount("a")
+	requireClose(t, 100000, n)
+	n, _ = c.PFCount("a", "b")
+	requireClose(t, 150000, n)
+
+	require.NoError(t, c.PFMerge("ab", "a", "b"))
+	n, _ = c.PFCount("ab")
+	requireClose(t, 150000, n)
+
+	changed, _ := c.PFAdd("a", "1")
+	require.False(t, changed)
+
+	var buf bytes.Buffer
+	require.NoError(t, c.saveItem(&buf))
+	c2 := NewClient(time.Minute, time.Minute)
+	defer c2.StopGC()
+	require.NoError(t, c2.load(&buf, 1))
+	n, _ = c2.PFCount("small")
+	require.Equal(t, uint64(100), n)
+	n2, _ := c.PFCount("ab")
+	n, _ = c2.PFCount("ab")
+	require.Equal(t, n2, n)
+}
+
+func TestHyperLogLogCopyOnWrite(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	_, err := c.PFAdd("sparse", "a")
+	require.NoError(t, err)
+	for i := 0; i < 10000; i++ {
+		c.PFAdd("dense", strconv.Itoa(i))
+	}
+	s := c.Snapshot()
+	for i := 0; i < 10000; i++ {
+		c.PFAdd("sparse", strconv.Itoa(i))
+		c.PFAdd("dense", strconv.Itoa(i+10000))
+	}
+	require.NoError(t, c.PFMerge("dense", "sparse"))
+
+	// 快照里的寄存器不受之后的写入影响
+	v, _ := s.Get("sparse")
+	require.Equal(t, uint64(1), v.(*HyperLogLog).count())
+	v, _ = s.Get("dense")
+	requireClose(t, 10000, v.(*HyperLogLog).count())
+	n, _ := c.PFCount("dense")
+	requireClose(t, 20000, n)
+
+	// 没有交出去的HyperLogLog原地修改
+	first := c.items["dense"].Object
+	c.PFAdd("dense", "x")
+	require.NoError(t, c.PFMerge("dense", "sparse"))
+	require.Same(t, first, c.items["dense"].Object)
+}
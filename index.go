@@ -0,0 +1,166 @@
+package cache
+
+import (
+	"fmt"
+	"sort"
+)
+
+// index 二级索引，维护索引值到key的映射
+type index struct {
+	extractor func(v interface{}) (string, bool) // 从value中提取索引值，返回false表示不参与索引
+	values    map[string]map[string]bool         // 索引值 -> key集合
+	keys      map[string]string                  // key -> 索引值
+}
+
+func newIndex(extractor func(v interface{}) (string, bool)) *index {
+	return &index{
+		extractor: extractor,
+		values:    make(map[string]map[string]bool),
+		keys:      make(map[string]string),
+	}
+}
+
+// put 重新计算key的索引值
+func (idx *index) put(k string, x interface{}) {
+	idx.remove(k)
+	v, ok := idx.extractor(x)
+	if !ok {
+		return
+	}
+	if idx.values[v] == nil {
+		idx.values[v] = make(map[string]bool)
+	}
+	idx.values[v][k] = true
+	idx.keys[k] = v
+}
+
+// remove 从索引中删除key
+func (idx *index) remove(k string) {
+	v, ok := idx.keys[k]
+	if !ok {
+		return
+	}
+	delete(idx.keys, k)
+	delete(idx.values[v], k)
+	if len(idx.values[v]) == 0 {
+		delete(idx.values, v)
+	}
+}
+
+// indexSet 写入key之后同步所有的二级索引，外部加写锁
+func (c *Cache) indexSet(k string, x interface{}) {
+	for _, idx := range c.indexes {
+		idx.put(k, x)
+	}
+}
+
+// indexDelete 删除key之后同步所有的二级索引，外部加写锁
+func (c *Cache) indexDelete(k string) {
+	for _, idx := range c.indexes {
+		idx.remove(k)
+	}
+}
+
+// rebuildIndexes 根据当前的数据重建所有的二级索引，外部加写锁
+func (c *Cache) rebuildIndexes() {
+	for name, idx := range c.indexes {
+		c.indexes[name] = c.buildIndex(idx.extractor)
+	}
+}
+
+// buildIndex 扫描所有未过期的数据建立一个索引，外部加锁
+func (c *Cache) buildIndex(extractor func(v interface{}) (string, bool)) *index {
+	idx := newIndex(extractor)
+	c.rangeItems(func(k string, item Item) bool {
+		if !item.expired() {
+			idx.put(k, item.Object)
+		}
+		return true
+	})
+	return idx
+}
+
+// CreateIndex 创建一个二级索引，extractor从value中提取索引值，
+// 返回false的value不会被索引，索引会在写入、删除、过期和Load时自动维护
+func (c *Cache) CreateIndex(name string, extractor func(v interface{}) (string, bool)) error {
+	if extractor == nil {
+		return fmt.Errorf("extractor of index %s is nil", name)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.indexes[name]; ok {
+		return fmt.Errorf("index %s already exists", name)
+	}
+	c.indexes[name] = c.buildIndex(extractor)
+	return nil
+}
+
+// DropIndex 删除一个二级索引
+func (c *Cache) DropIndex(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.indexes[name]; !ok {
+		return fmt.Errorf("index %s doesn't exist", name)
+	}
+	delete(c.indexes, name)
+	return nil
+}
+
+// GetByIndex 通过索引值查询所有匹配的key-value
+func (c *Cache) GetByIndex(name, value string) (map[string]interface{}, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	idx, ok := c.indexes[name]
+	if !ok {
+		return nil, fmt.Errorf("index %s doesn't exist", name)
+	}
+
+	c.share()
+	m := make(map[string]interface{}, len(idx.values[value]))
+	for k := range idx.values[value] {
+		item, ok := c.lookup(k)
+		if !ok {
+			continue
+		}
+		m[k] = item.Object
+	}
+	return m, nil
+}
+
+// RangeIndex 查询索引值在[from, to]之间的key，按照索引值和key排序，
+// to为空表示没有上界
+func (c *Cache) RangeIndex(name, from, to string) ([]string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	idx, ok := c.indexes[name]
+	if !ok {
+		return nil, fmt.Errorf("index %s doesn't exist", name)
+	}
+
+	values := make([]string, 0)
+	for v := range idx.values {
+		if v < from || (to != "" && v > to) {
+			continue
+		}
+		values = append(values, v)
+	}
+	sort.Strings(values)
+
+	keys := make([]string, 0)
+	for _, v := range values {
+		group := make([]string, 0, len(idx.values[v]))
+		for k := range idx.values[v] {
+			if c.alive(k) {
+				group = append(group, k)
+			}
+		}
+		sort.Strings(group)
+		keys = append(keys, group...)
+	}
+	return keys, nil
+}
@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testUser struct {
+	ID    int
+	Email string
+}
+
+func TestIndex(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	c.Set("user:1", testUser{1, "a@x.com"}, NoExpiration)
+	c.Set("user:2", testUser{2, "b@x.com"}, NoExpiration)
+	c.Set("other", 1, NoExpiration)
+
+	err := c.CreateIndex("email", func(v interface{}) (string, bool) {
+		u, ok := v.(testUser)
+		return u.Email, ok
+	})
+	require.NoError(t, err)
+	require.Error(t, c.CreateIndex("email", nil))
+	require.Error(t, c.CreateIndex("nil", nil))
+
+	m, err := c.GetByIndex("email", "a@x.com")
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"user:1": testUser{1, "a@x.com"}}, m)
+
+	// 写入、替换和删除之后索引同步更新
+	require.NoError(t, c.Add("user:3", testUser{3, "c@x.com"}, NoExpiration))
+	require.NoError(t, c.Replace("user:1", testUser{1, "d@x.com"}, NoExpiration))
+	c.Delete("user:2")
+
+	m, _ = c.GetByIndex("email", "a@x.com")
+	require.Empty(t, m)
+	keys, err := c.RangeIndex("email", "b", "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"user:3", "user:1"}, keys)
+
+	_, err = c.GetByIndex("id", "1")
+	require.Error(t, err)
+}
+
+func emailIndex(v interface{}) (string, bool) {
+	u, ok := v.(testUser)
+	return u.Email, ok
+}
+
+func TestIndexExpiration(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	require.NoError(t, c.CreateIndex("email", emailIndex))
+	c.Set("user:1", testUser{1, "a@x.com"}, time.Millisecond)
+	c.Set("user:2", testUser{2, "a@x.com"}, NoExpiration)
+	time.Sleep(2 * time.Millisecond)
+
+	// 过期还没有被gc清理时查询不到
+	m, err := c.GetByIndex("email", "a@x.com")
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"user:2": testUser{2, "a@x.com"}}, m)
+
+	// gc清理之后从索引中删除
+	c.delete()
+	c.mu.RLock()
+	require.Equal(t, map[string]bool{"user:2": true}, c.indexes["email"].values["a@x.com"])
+	require.NotContains(t, c.indexes["email"].keys, "user:1")
+	c.mu.RUnlock()
+	keys, err := c.RangeIndex("email", "", "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"user:2"}, keys)
+}
+
+func TestIndexLoad(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	c.Set("user:1", testUser{1, "a@x.com"}, NoExpiration)
+	c.Set("user:2", testUser{2, "b@x.com"}, NoExpiration)
+	var buf bytes.Buffer
+	require.NoError(t, c.saveItem(&buf))
+
+	// Load之后根据加载的数据重建索引
+	c2 := NewClient(time.Minute, time.Minute)
+	defer c2.StopGC()
+	require.NoError(t, c2.CreateIndex("email", emailIndex))
+	// 已经存在的key不会被覆盖，索引值也不变
+	c2.Set("user:1", testUser{1, "old@x.com"}, NoExpiration)
+	require.NoError(t, c2.load(&buf, 1))
+
+	m, err := c2.GetByIndex("email", "b@x.com")
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"user:2": testUser{2, "b@x.com"}}, m)
+	m, _ = c2.GetByIndex("email", "a@x.com")
+	require.Empty(t, m)
+	keys, err := c2.RangeIndex("email", "", "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"user:2", "user:1"}, keys)
+}
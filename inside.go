@@ -1,10 +1,14 @@
 package cache
 
 import (
+	"container/heap"
 	"encoding/gob"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"reflect"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,7 +19,7 @@ func (c *Cache) getType(v interface{}) string {
 
 // autoDelete 自动删除某个过期key，这里一定是过期的
 func (c *Cache) autoDelete(k string) {
-	item := c.items[k]
+	item, _ := c.getItem(k)
 	del := delItem{
 		itemType:      item.getType(),
 		Object:        item.Object,
@@ -24,13 +28,14 @@ func (c *Cache) autoDelete(k string) {
 		deletedAt:     time.Now(),
 	}
 
-	delete(c.items, k)
+	c.removeItem(k)
 	c.delMap[k] = del
+	c.indexDelete(k)
 }
 
 // manualDelete 手动删除一个key
 func (c *Cache) manualDelete(k string) {
-	item := c.items[k]
+	item, _ := c.getItem(k)
 	del := delItem{
 		itemType:      item.getType(),
 		Object:        item.Object,
@@ -40,12 +45,13 @@ func (c *Cache) manualDelete(k string) {
 	}
 
 	// 先判断这个key有没有过期
-	if c.items[k].expired() {
+	if item.expired() {
 		del.isExpired = true
 	}
 
-	delete(c.items, k)
+	c.removeItem(k)
 	c.delMap[k] = del
+	c.indexDelete(k)
 }
 
 // delete 扫描所有key，过期删除
@@ -53,11 +59,28 @@ func (c *Cache) delete() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	now := time.Now().UnixNano()
 	for k, item := range c.items {
+		// 未过期的value如果有内部的过期数据，先清理，清理之后为空时和过期一样删除
 		if !item.expired() {
-			continue
+			s, ok := item.Object.(sweeper)
+			if !ok {
+				continue
+			}
+			swept, empty := s.sweep(now)
+			if !empty {
+				if swept != nil {
+					item.Object = swept
+					c.items[k] = item
+					delete(c.owned, k)
+					c.indexSet(k, swept)
+				}
+				continue
+			}
 		}
 		delete(c.items, k)
+		delete(c.owned, k)
+		c.indexDelete(k)
 		c.delMap[k] = delItem{
 			itemType:      item.getType(),
 			Object:        item.Object,
@@ -66,313 +89,93 @@ func (c *Cache) delete() {
 			deletedAt:     time.Now(),
 		}
 	}
-}
-
-func (c *Cache) incrementInt(k string, n interface{}) (int, error) {
-	item := c.items[k]
-	switch item.Object.(type) {
-	case int:
-		item.Object = item.Object.(int) + n.(int)
-	default:
-		return 0, fmt.Errorf("type mismatch")
-	}
-	c.items[k] = item
-	return item.Object.(int), nil
-}
-
-func (c *Cache) incrementInt8(k string, n interface{}) (int8, error) {
-	item := c.items[k]
-	switch item.Object.(type) {
-	case int8:
-		item.Object = item.Object.(int8) + n.(int8)
-	default:
-		return 0, fmt.Errorf("type mismatch")
-	}
-	c.items[k] = item
-	return item.Object.(int8), nil
-}
-
-func (c *Cache) incrementInt16(k string, n interface{}) (int16, error) {
-	item := c.items[k]
-	switch item.Object.(type) {
-	case int16:
-		item.Object = item.Object.(int16) + n.(int16)
-	default:
-		return 0, fmt.Errorf("type mismatch")
-	}
-	c.items[k] = item
-	return item.Object.(int16), nil
-}
-
-func (c *Cache) incrementInt32(k string, n interface{}) (int32, error) {
-	item := c.items[k]
-	switch item.Object.(type) {
-	case int32:
-		item.Object = item.Object.(int32) + n.(int32)
-	default:
-		return 0, fmt.Errorf("type mismatch")
-	}
-	c.items[k] = item
-	return item.Object.(int32), nil
-}
-
-func (c *Cache) incrementInt64(k string, n interface{}) (int64, error) {
-	item := c.items[k]
-	switch item.Object.(type) {
-	case int64:
-		item.Object = item.Object.(int64) + n.(int64)
-	default:
-		return 0, fmt.Errorf("type mismatch")
-	}
-	c.items[k] = item
-	return item.Object.(int64), nil
-}
-
-func (c *Cache) incrementUint(k string, n interface{}) (uint, error) {
-	item := c.items[k]
-	switch item.Object.(type) {
-	case uint:
-		item.Object = item.Object.(uint) + n.(uint)
-	default:
-		return 0, fmt.Errorf("type mismatch")
-	}
-	c.items[k] = item
-	return item.Object.(uint), nil
-}
-
-func (c *Cache) incrementUint8(k string, n interface{}) (uint8, error) {
-	item := c.items[k]
-	switch item.Object.(type) {
-	case uint8:
-		item.Object = item.Object.(uint8) + n.(uint8)
-	default:
-		return 0, fmt.Errorf("type mismatch")
-	}
-	c.items[k] = item
-	return item.Object.(uint8), nil
-}
-
-func (c *Cache) incrementUint16(k string, n interface{}) (uint16, error) {
-	item := c.items[k]
-	switch item.Object.(type) {
-	case uint16:
-		item.Object = item.Object.(uint16) + n.(uint16)
-	default:
-		return 0, fmt.Errorf("type mismatch")
-	}
-	c.items[k] = item
-	return item.Object.(uint16), nil
-}
-
-func (c *Cache) incrementUint32(k string, n interface{}) (uint32, error) {
-	item := c.items[k]
-	switch item.Object.(type) {
-	case uint32:
-		item.Object = item.Object.(uint32) + n.(uint32)
-	default:
-		return 0, fmt.Errorf("type mismatch")
-	}
-	c.items[k] = item
-	return item.Object.(uint32), nil
-}
-
-func (c *Cache) incrementUint64(k string, n interface{}) (uint64, error) {
-	item := c.items[k]
-	switch item.Object.(type) {
-	case uint64:
-		item.Object = item.Object.(uint64) + n.(uint64)
-	default:
-		return 0, fmt.Errorf("type mismatch")
-	}
-	c.items[k] = item
-	return item.Object.(uint64), nil
-}
-
-func (c *Cache) incrementFloat32(k string, n interface{}) (float32, error) {
-	item := c.items[k]
-	switch item.Object.(type) {
-	case float32:
-		item.Object = item.Object.(float32) + n.(float32)
-	default:
-		return 0, fmt.Errorf("type mismatch")
-	}
-	c.items[k] = item
-	return item.Object.(float32), nil
-}
-
-func (c *Cache) incrementFloat64(k string, n interface{}) (float64, error) {
-	item := c.items[k]
-	switch item.Object.(type) {
-	case float64:
-		item.Object = item.Object.(float64) + n.(float64)
-	default:
-		return 0, fmt.Errorf("type mismatch")
-	}
-	c.items[k] = item
-	return item.Object.(float64), nil
-}
-
-func (c *Cache) decrementInt(k string, n interface{}) (int, error) {
-	item := c.items[k]
-	switch item.Object.(type) {
-	case int:
-		item.Object = item.Object.(int) - n.(int)
-	default:
-		return 0, fmt.Errorf("type mismatch")
-	}
-	c.items[k] = item
-	return item.Object.(int), nil
-}
 
-func (c *Cache) decrementInt8(k string, n interface{}) (int8, error) {
-	item := c.items[k]
-	switch item.Object.(type) {
-	case int8:
-		item.Object = item.Object.(int8) - n.(int8)
-	default:
-		return 0, fmt.Errorf("type mismatch")
-	}
-	c.items[k] = item
-	return item.Object.(int8), nil
-}
-
-func (c *Cache) decrementInt16(k string, n interface{}) (int16, error) {
-	item := c.items[k]
-	switch item.Object.(type) {
-	case int16:
-		item.Object = item.Object.(int16) - n.(int16)
-	default:
-		return 0, fmt.Errorf("type mismatch")
-	}
-	c.items[k] = item
-	return item.Object.(int16), nil
-}
-
-func (c *Cache) decrementInt32(k string, n interface{}) (int32, error) {
-	item := c.items[k]
-	switch item.Object.(type) {
-	case int32:
-		item.Object = item.Object.(int32) - n.(int32)
-	default:
-		return 0, fmt.Errorf("type mismatch")
+	// slab里的数据没有内部的过期时间，只需要清理过期的key
+	if c.slab != nil {
+		var expired []string
+		c.slab.each(func(k string, _ []byte, e int64, _ byte) bool {
+			if e > 0 && now > e {
+				expired = append(expired, k)
+			}
+			return true
+		})
+		for _, k := range expired {
+			c.autoDelete(k)
+		}
 	}
-	c.items[k] = item
-	return item.Object.(int32), nil
 }
 
-func (c *Cache) decrementInt64(k string, n interface{}) (int64, error) {
-	item := c.items[k]
-	switch item.Object.(type) {
-	case int64:
-		item.Object = item.Object.(int64) - n.(int64)
-	default:
-		return 0, fmt.Errorf("type mismatch")
+func (c *Cache) set(k string, x interface{}, d time.Duration) {
+	var e int64
+	if d == DefaultExpiration {
+		d = c.defaultExpiration
 	}
-	c.items[k] = item
-	return item.Object.(int64), nil
-}
-
-func (c *Cache) decrementUint(k string, n interface{}) (uint, error) {
-	item := c.items[k]
-	switch item.Object.(type) {
-	case uint:
-		item.Object = item.Object.(uint) - n.(uint)
-	default:
-		return 0, fmt.Errorf("type mismatch")
+	if d > 0 {
+		e = time.Now().Add(d).UnixNano()
 	}
-	c.items[k] = item
-	return item.Object.(uint), nil
+	c.setItem(k, Item{
+		itemType:   reflect.TypeOf(x).String(),
+		Object:     x,
+		Expiration: e,
+	})
+	c.indexSet(k, x)
 }
 
-func (c *Cache) decrementUint8(k string, n interface{}) (uint8, error) {
-	item := c.items[k]
-	switch item.Object.(type) {
-	case uint8:
-		item.Object = item.Object.(uint8) - n.(uint8)
-	default:
-		return 0, fmt.Errorf("type mismatch")
+// lookup 获取未过期的item，不会删除过期的数据，外部加读锁
+func (c *Cache) lookup(k string) (Item, bool) {
+	item, ok := c.getItem(k)
+	if !ok || item.expired() {
+		return Item{}, false
 	}
-	c.items[k] = item
-	return item.Object.(uint8), nil
+	return item, true
 }
 
-func (c *Cache) decrementUint16(k string, n interface{}) (uint16, error) {
-	item := c.items[k]
-	switch item.Object.(type) {
-	case uint16:
-		item.Object = item.Object.(uint16) - n.(uint16)
-	default:
-		return 0, fmt.Errorf("type mismatch")
+// add 新建一个key，过期的旧数据会先被自动清理，外部加写锁
+func (c *Cache) add(k string, x interface{}, d time.Duration) {
+	if e, ok := c.itemExpiration(k); ok && e > 0 && time.Now().UnixNano() > e {
+		c.autoDelete(k)
 	}
-	c.items[k] = item
-	return item.Object.(uint16), nil
+	c.set(k, x, d)
+	c.insertKey(k)
+	c.size++
 }
 
-func (c *Cache) decrementUint32(k string, n interface{}) (uint32, error) {
-	item := c.items[k]
-	switch item.Object.(type) {
-	case uint32:
-		item.Object = item.Object.(uint32) - n.(uint32)
-	default:
-		return 0, fmt.Errorf("type mismatch")
+// put 写入key并重新设置过期时间，key不存在时新建，外部加写锁
+func (c *Cache) put(k string, x interface{}, d time.Duration) {
+	if _, ok := c.lookup(k); ok {
+		c.set(k, x, d)
+		return
 	}
-	c.items[k] = item
-	return item.Object.(uint32), nil
+	c.add(k, x, d)
 }
 
-func (c *Cache) decrementUint64(k string, n interface{}) (uint64, error) {
-	item := c.items[k]
-	switch item.Object.(type) {
-	case uint64:
-		item.Object = item.Object.(uint64) - n.(uint64)
-	default:
-		return 0, fmt.Errorf("type mismatch")
-	}
-	c.items[k] = item
-	return item.Object.(uint64), nil
+// update 替换key的value，保留原来的过期时间，外部加写锁
+func (c *Cache) update(k string, x interface{}) {
+	item, _ := c.getItem(k)
+	item.Object = x
+	c.setItem(k, item)
+	c.indexSet(k, x)
 }
 
-func (c *Cache) decrementFloat32(k string, n interface{}) (float32, error) {
-	item := c.items[k]
-	switch item.Object.(type) {
-	case float32:
-		item.Object = item.Object.(float32) - n.(float32)
-	default:
-		return 0, fmt.Errorf("type mismatch")
-	}
-	c.items[k] = item
-	return item.Object.(float32), nil
+// share 记录value被交给了外部，之前复制出来的value都不能再原地修改，读锁下调用
+func (c *Cache) share() {
+	atomic.AddUint64(&c.shared, 1)
 }
 
-func (c *Cache) decrementFloat64(k string, n interface{}) (float64, error) {
-	item := c.items[k]
-	switch item.Object.(type) {
-	case float64:
-		item.Object = item.Object.(float64) - n.(float64)
-	default:
-		return 0, fmt.Errorf("type mismatch")
-	}
-	c.items[k] = item
-	return item.Object.(float64), nil
+// owns 判断key的value是不是写入方复制出来之后还没有交给过外部，是的话可以原地修改，
+// 不用每次写入都复制整个value，外部加写锁
+func (c *Cache) owns(k string) bool {
+	e, ok := c.owned[k]
+	return ok && e == atomic.LoadUint64(&c.shared)
 }
 
-func (c *Cache) set(k string, x interface{}, d time.Duration) {
-	var e int64
-	if d == DefaultExpiration {
-		d = c.defaultExpiration
-	}
-	if d > 0 {
-		e = time.Now().Add(d).UnixNano()
-	}
-	c.items[k] = Item{
-		itemType:   reflect.TypeOf(x).String(),
-		Object:     x,
-		Expiration: e,
-	}
+// own 记录key当前的value是写入方复制出来的，在写入value之后调用，外部加写锁
+func (c *Cache) own(k string) {
+	c.owned[k] = atomic.LoadUint64(&c.shared)
 }
 
 func (c *Cache) get(k string) (interface{}, bool) {
-	item, ok := c.items[k]
+	item, ok := c.getItem(k)
 	if !ok {
 		return nil, false
 	}
@@ -383,9 +186,32 @@ func (c *Cache) get(k string) (interface{}, bool) {
 	return item.Object, true
 }
 
+// registerGob 向gob注册数据类型，容器类型还要注册其中的元素类型
+func registerGob(v interface{}) {
+	if v == nil {
+		return
+	}
+	gob.Register(v)
+	switch x := v.(type) {
+	case List:
+		for _, e := range x {
+			registerGob(e)
+		}
+	case Hash:
+		for _, e := range x.Fields {
+			registerGob(e)
+		}
+	case *Stream:
+		for _, e := range x.Entries {
+			for _, f := range e.Fields {
+				registerGob(f)
+			}
+		}
+	}
+}
+
 // Save 使用gob编码将cache内容写到io.Writer
 func (c *Cache) saveItem(w io.Writer) (err error) {
-	enc := gob.NewEncoder(w)
 	defer func() {
 		if x := recover(); x != nil {
 			err = fmt.Errorf("error registering item types with Gob library")
@@ -394,15 +220,22 @@ func (c *Cache) saveItem(w io.Writer) (err error) {
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	for _, v := range c.items {
-		gob.Register(v.Object)
-	}
-	err = enc.Encode(&c.items)
+	items := c.items
+	if c.slab != nil {
+		items = make(map[string]Item, c.itemCount())
+		c.rangeStored(func(k string, v Item) bool {
+			items[k] = v
+			return true
+		})
+	}
+	for _, v := range items {
+		registerGob(v.Object)
+	}
+	err = c.encode(w, &items)
 	return
 }
 
 func (c *Cache) saveDel(w io.Writer) (err error) {
-	enc := gob.NewEncoder(w)
 	defer func() {
 		if x := recover(); x != nil {
 			err = fmt.Errorf("error registering item type with Gob library")
@@ -412,35 +245,239 @@ func (c *Cache) saveDel(w io.Writer) (err error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	for _, v := range c.delMap {
-		gob.Register(v.Object)
+		registerGob(v.Object)
 	}
-	err = enc.Encode(&c.delMap)
+	err = c.encode(w, &c.delMap)
 	return
 }
 
 func (c *Cache) load(r io.Reader, seq int) error {
+	r, err := c.decryptReader(r)
+	if err != nil {
+		return err
+	}
 	dec := gob.NewDecoder(r)
 	items := map[string]Item{}
-	err := dec.Decode(&items)
+	err = dec.Decode(&items)
 	if err == nil {
+		// 压缩的数据先解压检查一遍，损坏的数据在加载时报错，不会在Get时看起来像是key不存在
+		for k, v := range items {
+			if cv, ok := v.Object.(compressedValue); ok {
+				if _, ok := c.codec(cv.Codec); !ok {
+					return fmt.Errorf("the value for %s is compressed by %s which is not configured", k, cv.Codec)
+				}
+				if err := cv.check(c); err != nil {
+					return fmt.Errorf("the value for %s is corrupted: %v", k, err)
+				}
+			}
+		}
 		c.mu.Lock()
 		defer c.mu.Unlock()
 		for k, v := range items {
-			if ov, found := c.items[k]; !found || ov.expired() {
-				c.items[k] = v
+			if e, found := c.itemExpiration(k); !found || (e > 0 && time.Now().UnixNano() > e) {
+				c.setItem(k, v)
+				c.insertKey(k)
 			}
 		}
+		c.rebuildIndexes()
 		c.persistSeq = seq + 1
 	}
 	return err
 }
 
-// insertKey 向字典树中加入key，外部加锁
+// insertKey 向字典树中加入新建的key，删除或者过期的同名key留在树上的访问次数和分数会被清除，外部加写锁
 func (c *Cache) insertKey(k string) {
-	c.prefixTree.insert(k)
+	c.prefixTree.insert(k).resetRank()
 }
 
 // 查询是否有带有某个前缀的key
 func (c *Cache) searchWithPrefix(prefix string) bool {
 	return c.prefixTree.startsWithPrefix(prefix)
 }
+
+// alive 判断key是否存在且未过期，外部加读锁
+func (c *Cache) alive(k string) bool {
+	e, ok := c.itemExpiration(k)
+	return ok && (e == 0 || time.Now().UnixNano() <= e)
+}
+
+// hasAlive 判断字典树的某个子树下是否还有未过期的key，外部加读锁
+func (c *Cache) hasAlive(node *trie, path string) bool {
+	if node.isEnd && c.alive(path) {
+		return true
+	}
+	for ch, child := range node.children {
+		if c.hasAlive(child, path+string(ch)) {
+			return true
+		}
+	}
+	return false
+}
+
+// lister 按照目录的层级遍历字典树，生成List的结果
+type lister struct {
+	c         *Cache
+	prefix    string // 查询的前缀
+	delimiter string // 层级分隔符
+	marker    string // 从这个位置之后开始返回
+	maxKeys   int    // 本页最多返回的数量
+	count     int    // 本页已经返回的数量
+	last      string // 本页最后一个返回的key或者子目录
+	res       ListResult
+}
+
+// emit 输出一个key或者子目录，返回false表示本页已满
+func (l *lister) emit(entry string, isPrefix bool) bool {
+	if l.count == l.maxKeys {
+		l.res.IsTruncated = true
+		l.res.NextMarker = l.last
+		return false
+	}
+	if isPrefix {
+		l.res.CommonPrefixes = append(l.res.CommonPrefixes, entry)
+	} else {
+		l.res.Keys = append(l.res.Keys, entry)
+	}
+	l.count++
+	l.last = entry
+	return true
+}
+
+// walk 按字典序深度优先遍历，遇到分隔符就折叠成一个子目录，不再向下展开
+func (l *lister) walk(node *trie, path string) bool {
+	rest := path[len(l.prefix):]
+	if l.delimiter != "" && rest != "" && strings.HasSuffix(rest, l.delimiter) {
+		if path <= l.marker || !l.c.hasAlive(node, path) {
+			return true
+		}
+		return l.emit(path, true)
+	}
+
+	// 整棵子树都在marker之前，直接跳过
+	if path < l.marker && !strings.HasPrefix(l.marker, path) {
+		return true
+	}
+
+	if node.isEnd && path > l.marker && l.c.alive(path) {
+		if !l.emit(path, false) {
+			return false
+		}
+	}
+	for _, ch := range node.sortedChildren() {
+		if !l.walk(node.children[ch], path+string(ch)) {
+			return false
+		}
+	}
+	return true
+}
+
+// suggestion 一个候选的补全结果
+type suggestion struct {
+	key  string
+	rank float64
+}
+
+// less 排序分数低的在前，分数相同时字典序大的在前
+func (s suggestion) less(o suggestion) bool {
+	if s.rank != o.rank {
+		return s.rank < o.rank
+	}
+	return s.key > o.key
+}
+
+// suggestHeap 小顶堆，只保留排名最高的n个候选
+type suggestHeap []suggestion
+
+func (h suggestHeap) Len() int            { return len(h) }
+func (h suggestHeap) Less(i, j int) bool  { return h[i].less(h[j]) }
+func (h suggestHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *suggestHeap) Push(x interface{}) { *h = append(*h, x.(suggestion)) }
+func (h *suggestHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// collectSuggestions 遍历子树，把未过期的key放进堆里，外部加读锁
+func (c *Cache) collectSuggestions(node *trie, path string, n int, h *suggestHeap) {
+	if node.isEnd && c.alive(path) {
+		s := suggestion{key: path, rank: node.rank()}
+		if h.Len() < n {
+			heap.Push(h, s)
+		} else if (*h)[0].less(s) {
+			(*h)[0] = s
+			heap.Fix(h, 0)
+		}
+	}
+	for ch, child := range node.children {
+		c.collectSuggestions(child, path+string(ch), n, h)
+	}
+}
+
+// hash64 计算字符串的64位哈希，fnv的结果再经过一次混淆，让每一位都足够随机
+func hash64(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// watcher 等待同一个key发生变化的调用方共用的通道，n是还在等待的调用方数量
+type watcher struct {
+	ch chan struct{}
+	n  int
+}
+
+// watch 返回一个在key下一次发生变化时关闭的通道，不再等待时要调用unwatch，外部加写锁
+func (c *Cache) watch(k string) <-chan struct{} {
+	w, ok := c.watchers[k]
+	if !ok {
+		w = &watcher{ch: make(chan struct{})}
+		c.watchers[k] = w
+	}
+	w.n++
+	return w.ch
+}
+
+// unwatch 通道还没有关闭时取消一次等待，没有调用方在等待时删除这个通道，外部加写锁
+func (c *Cache) unwatch(k string, ch <-chan struct{}) {
+	w, ok := c.watchers[k]
+	if !ok || w.ch != ch {
+		return
+	}
+	w.n--
+	if w.n == 0 {
+		delete(c.watchers, k)
+	}
+}
+
+// notify 唤醒所有等待key发生变化的调用方，外部加写锁
+func (c *Cache) notify(k string) {
+	if w, ok := c.watchers[k]; ok {
+		close(w.ch)
+		delete(c.watchers, k)
+	}
+}
+
+// wait 等待key对应的通道关闭或者到达deadline，到达deadline时取消等待并返回false
+func (c *Cache) wait(k string, ch <-chan struct{}, deadline time.Time) bool {
+	if d := time.Until(deadline); d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-ch:
+			return true
+		case <-timer.C:
+		}
+	}
+	c.mu.Lock()
+	c.unwatch(k, ch)
+	c.mu.Unlock()
+	return false
+}
@@ -33,3 +33,11 @@ type delItem struct {
 	isExpired     bool        // 在删除它的时候它是不是过期的
 	deletedAt     time.Time   // 删除的时间点
 }
+
+// expiresAt 返回过期的时间点，不会过期时返回零值
+func (item Item) expiresAt() time.Time {
+	if item.Expiration == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, item.Expiration)
+}
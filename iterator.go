@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"reflect"
+	"time"
+)
+
+// Iterator 在不复制数据的情况下遍历cache，可以按前缀、数据类型和自定义条件过滤，
+// 遍历时持有读锁，回调函数里不能调用cache的写方法
+type Iterator struct {
+	c         *Cache
+	prefix    string                             // 只遍历带有这个前缀的key
+	valueType string                             // 只遍历这个类型的value
+	filter    func(k string, v interface{}) bool // 自定义的过滤条件
+}
+
+// Iterator 新建一个遍历所有未过期数据的迭代器
+func (c *Cache) Iterator() *Iterator {
+	return &Iterator{c: c}
+}
+
+// WithPrefix 只遍历带有prefix前缀的key，会使用字典树缩小遍历范围
+func (it *Iterator) WithPrefix(prefix string) *Iterator {
+	it.prefix = prefix
+	return it
+}
+
+// WithType 只遍历指定类型的value，可以是具体的类型名如"int64"、"[]uint8"，
+// 也可以是constant.go里的INT、UINT、FLOAT、MAP、SLICE这几类，
+// 注意"int"和"uint"会被当作INT、UINT处理
+func (it *Iterator) WithType(t string) *Iterator {
+	it.valueType = t
+	return it
+}
+
+// Filter 只遍历满足pred的数据
+func (it *Iterator) Filter(pred func(k string, v interface{}) bool) *Iterator {
+	it.filter = pred
+	return it
+}
+
+// Each 依次对满足条件的数据调用fn，fn返回false时提前结束
+func (it *Iterator) Each(fn func(k string, v interface{}, expiresAt time.Time) bool) {
+	c := it.c
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	c.share()
+
+	visit := func(k string) bool {
+		item, ok := c.lookup(k)
+		if !ok || !it.match(k, item.Object) {
+			return true
+		}
+		return fn(k, item.Object, item.expiresAt())
+	}
+
+	if it.prefix != "" {
+		if node := c.prefixTree.searchPrefix(it.prefix); node != nil {
+			node.walk(it.prefix, visit)
+		}
+		return
+	}
+	c.rangeItems(func(k string, item Item) bool {
+		if item.expired() || !it.match(k, item.Object) {
+			return true
+		}
+		return fn(k, item.Object, item.expiresAt())
+	})
+}
+
+// match 判断数据是否满足类型和自定义条件
+func (it *Iterator) match(k string, v interface{}) bool {
+	if it.valueType != "" && !matchType(v, it.valueType) {
+		return false
+	}
+	if it.filter != nil && !it.filter(k, v) {
+		return false
+	}
+	return true
+}
+
+// matchType 判断value是否属于指定的类型
+func matchType(v interface{}, t string) bool {
+	if v == nil {
+		return false
+	}
+	switch reflect.TypeOf(v).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if t == INT {
+			return true
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if t == UINT {
+			return true
+		}
+	case reflect.Float32, reflect.Float64:
+		if t == FLOAT {
+			return true
+		}
+	case reflect.Map:
+		if t == MAP {
+			return true
+		}
+	case reflect.Slice:
+		if t == SLICE {
+			return true
+		}
+	}
+	return reflect.TypeOf(v).String() == t
+}
+
+// Range 遍历所有未过期的数据，不复制整个map，fn返回false时提前结束，
+// 不会过期的数据expiresAt为零值
+func (c *Cache) Range(fn func(k string, v interface{}, expiresAt time.Time) bool) {
+	c.Iterator().Each(fn)
+}
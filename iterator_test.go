@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIterator(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	c.Set("a/1", 1, NoExpiration)
+	c.Set("a/2", "two", time.Hour)
+	c.Set("a/3", int64(3), NoExpiration)
+	c.Set("b/1", 4, NoExpiration)
+	c.Set("a/4", 5, time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+
+	count := 0
+	c.Range(func(k string, v interface{}, expiresAt time.Time) bool {
+		count++
+		if k == "a/2" {
+			require.False(t, expiresAt.IsZero())
+		}
+		return true
+	})
+	require.Equal(t, 4, count)
+
+	collect := func(it *Iterator) []string {
+		keys := make([]string, 0)
+		it.Each(func(k string, v interface{}, expiresAt time.Time) bool {
+			keys = append(keys, k)
+			return true
+		})
+		sort.Strings(keys)
+		return keys
+	}
+	require.Equal(t, []string{"a/1", "a/2", "a/3"}, collect(c.Iterator().WithPrefix("a/")))
+	require.Equal(t, []string{"a/1", "a/3"}, collect(c.Iterator().WithPrefix("a/").WithType(INT)))
+	require.Equal(t, []string{"a/3"}, collect(c.Iterator().WithType("int64")))
+	require.Equal(t, []string{"b/1"}, collect(c.Iterator().Filter(func(k string, v interface{}) bool {
+		n, ok := v.(int)
+		return ok && n > 1
+	})))
+
+	// 提前结束
+	count = 0
+	c.Range(func(k string, v interface{}, expiresAt time.Time) bool {
+		count++
+		return false
+	})
+	require.Equal(t, 1, count)
+}
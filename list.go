@@ -0,0 +1,231 @@
+package cache
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// List 列表类型的value，通过LPush、RPush等方法原子地修改
+type List []interface{}
+
+// listRange 把可以为负数的[start, stop]下标转换成切片的[from, to)，区间为空时返回false
+func listRange(start, stop, n int) (int, int, bool) {
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop || start >= n {
+		return 0, 0, false
+	}
+	return start, stop + 1, true
+}
+
+// getList 获取key对应的列表，key不存在或者已经过期时返回false，外部加锁
+func (c *Cache) getList(k string) (List, bool, error) {
+	item, ok := c.lookup(k)
+	if !ok {
+		return nil, false, nil
+	}
+	l, ok := item.Object.(List)
+	if !ok {
+		return nil, false, fmt.Errorf("the value for %s is not a list", k)
+	}
+	return l, true, nil
+}
+
+// putList 写回修改后的列表，列表为空时删除这个key，外部加写锁
+func (c *Cache) putList(k string, l List) {
+	if len(l) == 0 {
+		c.manualDelete(k)
+		return
+	}
+	c.update(k, l)
+}
+
+// push 向列表的头部或者尾部加入数据，key不存在时使用默认过期时间新建
+func (c *Cache) push(k string, left bool, values []interface{}) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	l, ok, err := c.getList(k)
+	if err != nil {
+		return 0, err
+	}
+
+	n := make(List, 0, len(l)+len(values))
+	if left {
+		for i := len(values) - 1; i >= 0; i-- {
+			n = append(n, values[i])
+		}
+		n = append(n, l...)
+	} else {
+		n = append(n, l...)
+		n = append(n, values...)
+	}
+
+	if !ok {
+		c.add(k, n, DefaultExpiration)
+	} else {
+		c.update(k, n)
+	}
+	return len(n), nil
+}
+
+// pop 从列表的头部或者尾部取出一个数据
+func (c *Cache) pop(k string, left bool) (interface{}, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	l, ok, err := c.getList(k)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	var x interface{}
+	if left {
+		x, l = l[0], l[1:]
+	} else {
+		x, l = l[len(l)-1], l[:len(l)-1]
+	}
+	c.putList(k, l)
+	return x, true, nil
+}
+
+// LPush 把values依次插入到列表的头部，返回插入后列表的长度，
+// key不存在时使用默认过期时间新建一个列表
+func (c *Cache) LPush(k string, values ...interface{}) (int, error) {
+	return c.push(k, true, values)
+}
+
+// RPush 把values依次追加到列表的尾部，返回追加后列表的长度，
+// key不存在时使用默认过期时间新建一个列表
+func (c *Cache) RPush(k string, values ...interface{}) (int, error) {
+	return c.push(k, false, values)
+}
+
+// LPop 取出列表头部的数据，列表为空或者不存在时返回false，取空的列表会被删除
+func (c *Cache) LPop(k string) (interface{}, bool, error) {
+	return c.pop(k, true)
+}
+
+// RPop 取出列表尾部的数据，列表为空或者不存在时返回false，取空的列表会被删除
+func (c *Cache) RPop(k string) (interface{}, bool, error) {
+	return c.pop(k, false)
+}
+
+// LRange 返回列表中[start, stop]区间的数据，下标为负数时从尾部开始计算
+func (c *Cache) LRange(k string, start, stop int) ([]interface{}, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	l, _, err := c.getList(k)
+	if err != nil {
+		return nil, err
+	}
+	from, to, ok := listRange(start, stop, len(l))
+	if !ok {
+		return []interface{}{}, nil
+	}
+	res := make([]interface{}, to-from)
+	copy(res, l[from:to])
+	return res, nil
+}
+
+// LLen 返回列表的长度，key不存在时返回0
+func (c *Cache) LLen(k string) (int, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	l, _, err := c.getList(k)
+	return len(l), err
+}
+
+// LTrim 只保留列表中[start, stop]区间的数据，区间为空时删除整个列表
+func (c *Cache) LTrim(k string, start, stop int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	l, ok, err := c.getList(k)
+	if err != nil || !ok {
+		return err
+	}
+	from, to, ok := listRange(start, stop, len(l))
+	if !ok {
+		c.putList(k, nil)
+		return nil
+	}
+	n := make(List, to-from)
+	copy(n, l[from:to])
+	c.putList(k, n)
+	return nil
+}
+
+// LIndex 返回列表中下标为index的数据，下标为负数时从尾部开始计算
+func (c *Cache) LIndex(k string, index int) (interface{}, bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	l, _, err := c.getList(k)
+	if err != nil {
+		return nil, false, err
+	}
+	if index < 0 {
+		index += len(l)
+	}
+	if index < 0 || index >= len(l) {
+		return nil, false, nil
+	}
+	return l[index], true, nil
+}
+
+// LRem 删除列表中等于value的数据，count大于0时从头部开始删除count个，
+// 小于0时从尾部开始删除-count个，等于0时全部删除，返回删除的数量
+func (c *Cache) LRem(k string, count int, value interface{}) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	l, ok, err := c.getList(k)
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+	removed := make([]bool, len(l))
+	n := 0
+	for i := range l {
+		j := i
+		if count < 0 {
+			j = len(l) - 1 - i
+		}
+		if limit > 0 && n == limit {
+			break
+		}
+		if reflect.DeepEqual(l[j], value) {
+			removed[j] = true
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	rest := make(List, 0, len(l)-n)
+	for i, x := range l {
+		if !removed[i] {
+			rest = append(rest, x)
+		}
+	}
+	c.putList(k, rest)
+	return n, nil
+}
@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListOps(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	n, err := c.RPush("l", 1, 2, 3)
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	n, _ = c.LPush("l", 0, -1)
+	require.Equal(t, 5, n)
+
+	res, err := c.LRange("l", 0, -1)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{-1, 0, 1, 2, 3}, res)
+	res, _ = c.LRange("l", -2, 100)
+	require.Equal(t, []interface{}{2, 3}, res)
+
+	x, ok, err := c.LIndex("l", -1)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 3, x)
+
+	x, ok, _ = c.LPop("l")
+	require.True(t, ok)
+	require.Equal(t, -1, x)
+	x, _, _ = c.RPop("l")
+	require.Equal(t, 3, x)
+
+	c.RPush("l", 1, 1)
+	n, _ = c.LRem("l", -2, 1)
+	require.Equal(t, 2, n)
+	res, _ = c.LRange("l", 0, -1)
+	require.Equal(t, []interface{}{0, 1, 2}, res)
+
+	require.NoError(t, c.LTrim("l", 1, 1))
+	n, _ = c.LLen("l")
+	require.Equal(t, 1, n)
+
+	// 取空之后key被删除
+	c.LPop("l")
+	require.False(t, c.IsExistedKey("l"))
+	require.True(t, c.SearchDel("l"))
+
+	c.Set("s", "str", NoExpiration)
+	_, err = c.LPush("s", 1)
+	require.Error(t, err)
+
+	// 持久化
+	c.RPush("p", "a", 2)
+	var buf bytes.Buffer
+	require.NoError(t, c.saveItem(&buf))
+	c2 := NewClient(time.Minute, time.Minute)
+	defer c2.StopGC()
+	require.NoError(t, c2.load(&buf, 1))
+	res, _ = c2.LRange("p", 0, -1)
+	require.Equal(t, []interface{}{"a", 2}, res)
+}
@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// lease 锁的持有凭证，过期时间就是item的过期时间，持有者崩溃之后锁会自动过期
+type lease struct {
+	Token string
+}
+
+// newToken 生成一个随机的凭证
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// getLease 获取key对应的锁，锁不存在或者已经过期时返回false，外部加锁
+func (c *Cache) getLease(k string) (lease, Item, bool, error) {
+	item, ok := c.lookup(k)
+	if !ok {
+		return lease{}, Item{}, false, nil
+	}
+	l, ok := item.Object.(lease)
+	if !ok {
+		return lease{}, Item{}, false, fmt.Errorf("the value for %s is not a lock", k)
+	}
+	return l, item, true, nil
+}
+
+// tryLock 尝试加锁，锁被别人持有时返回锁的过期时间，外部加写锁
+func (c *Cache) tryLock(k string, ttl time.Duration) (string, time.Time, error) {
+	_, item, ok, err := c.getLease(k)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if ok {
+		return "", item.expiresAt(), nil
+	}
+	token, err := newToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	c.add(k, lease{Token: token}, ttl)
+	return token, time.Time{}, nil
+}
+
+// checkLease 检查凭证是否是锁当前的持有者，外部加锁
+func (c *Cache) checkLease(k, token string) error {
+	l, _, ok, err := c.getLease(k)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("lock %s is not held", k)
+	}
+	if l.Token != token {
+		return fmt.Errorf("lock %s is held by others", k)
+	}
+	return nil
+}
+
+// Lock 加锁并返回凭证，ttl之后锁自动过期，锁被别人持有时返回错误
+func (c *Cache) Lock(k string, ttl time.Duration) (string, error) {
+	if ttl <= 0 {
+		return "", fmt.Errorf("ttl must be positive")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	token, _, err := c.tryLock(k, ttl)
+	if err != nil {
+		return "", err
+	}
+	if token == "" {
+		return "", fmt.Errorf("lock %s is held by others", k)
+	}
+	return token, nil
+}
+
+// LockWait 阻塞直到加锁成功或者ctx结束，锁被释放或者过期时会被唤醒
+func (c *Cache) LockWait(ctx context.Context, k string, ttl time.Duration) (string, error) {
+	if ttl <= 0 {
+		return "", fmt.Errorf("ttl must be positive")
+	}
+
+	for {
+		c.mu.Lock()
+		token, expiresAt, err := c.tryLock(k, ttl)
+		if err != nil || token != "" {
+			c.mu.Unlock()
+			return token, err
+		}
+		ch := c.watch(k)
+		c.mu.Unlock()
+
+		// 超时或者ctx结束时取消等待，没有人等待的通道不会留在watchers里
+		timer := time.NewTimer(time.Until(expiresAt))
+		select {
+		case <-ch:
+			timer.Stop()
+			continue
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		timer.Stop()
+		c.mu.Lock()
+		c.unwatch(k, ch)
+		c.mu.Unlock()
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+	}
+}
+
+// Unlock 使用加锁时得到的凭证释放锁，不能释放别人持有的锁
+func (c *Cache) Unlock(k, token string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.checkLease(k, token); err != nil {
+		return err
+	}
+	c.manualDelete(k)
+	c.notify(k)
+	return nil
+}
+
+// Extend 使用加锁时得到的凭证把锁的过期时间重新设置为ttl之后
+func (c *Cache) Extend(k, token string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("ttl must be positive")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.checkLease(k, token); err != nil {
+		return err
+	}
+	c.set(k, lease{Token: token}, ttl)
+	return nil
+}
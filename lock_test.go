@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLock(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	token, err := c.Lock("report", time.Minute)
+	require.NoError(t, err)
+	_, err = c.Lock("report", time.Minute)
+	require.Error(t, err)
+
+	require.Error(t, c.Unlock("report", "other"))
+	require.Error(t, c.Extend("report", "other", time.Minute))
+	require.NoError(t, c.Extend("report", token, time.Millisecond))
+
+	// 持有者没有释放，锁过期之后可以被别人拿到
+	time.Sleep(2 * time.Millisecond)
+	token2, err := c.Lock("report", time.Minute)
+	require.NoError(t, err)
+	require.Error(t, c.Unlock("report", token))
+	require.NoError(t, c.Unlock("report", token2))
+}
+
+func TestLockWait(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	var mu sync.Mutex
+	holders, maxHolders := 0, 0
+	// require不能在其他goroutine里使用，错误通过通道交给测试的goroutine检查
+	errs := make(chan error, 20)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := c.LockWait(context.Background(), "job", time.Minute)
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			mu.Lock()
+			holders++
+			if holders > maxHolders {
+				maxHolders = holders
+			}
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			holders--
+			mu.Unlock()
+
+			if err := c.Unlock("job", token); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	require.Equal(t, 1, maxHolders)
+
+	_, err := c.Lock("job", time.Minute)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = c.LockWait(ctx, "job", time.Minute)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	c.mu.RLock()
+	require.Empty(t, c.watchers)
+	c.mu.RUnlock()
+}
+
+func TestWatch(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	// 同一个key的等待方共用一个通道，最后一个等待方超时之后才删除
+	c.mu.Lock()
+	ch := c.watch("k")
+	require.Equal(t, ch, c.watch("k"))
+	c.mu.Unlock()
+	require.False(t, c.wait("k", ch, time.Now()))
+	c.mu.RLock()
+	require.Contains(t, c.watchers, "k")
+	c.mu.RUnlock()
+	require.False(t, c.wait("k", ch, time.Now().Add(time.Millisecond)))
+	c.mu.RLock()
+	require.Empty(t, c.watchers)
+	c.mu.RUnlock()
+
+	// 通道关闭之后的取消不影响新的等待方
+	c.mu.Lock()
+	old := c.watch("k")
+	c.notify("k")
+	ch = c.watch("k")
+	c.unwatch("k", old)
+	require.Contains(t, c.watchers, "k")
+	c.notify("k")
+	c.mu.Unlock()
+	require.True(t, c.wait("k", ch, time.Now().Add(time.Minute)))
+}
@@ -0,0 +1,239 @@
+package cache
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"time"
+)
+
+// OverflowMode 计数器溢出时的处理方式
+type OverflowMode int
+
+const (
+	OverflowError     OverflowMode = iota // 溢出时返回错误，value保持不变
+	OverflowSaturate                      // 溢出时取类型能表示的最大值或者最小值
+	OverflowFloorZero                     // 结果小于0时取0，向上溢出时返回错误
+)
+
+// CounterOptions IncrementBy和DecrementBy的参数
+type CounterOptions struct {
+	TTL  time.Duration // key不存在时新建计数器使用的过期时间，为0时使用默认过期时间
+	Mode OverflowMode  // 溢出时的处理方式
+}
+
+// IncrementBy 为指定的key增加n并返回新的值，新的值和原来的value类型相同，
+// key不存在时以n为初始值使用opts.TTL新建一个计数器，
+// n可以是任意能无损转换成value类型的整数或者浮点数，比如int可以加到int64上，2.0可以加到int上
+func (c *Cache) IncrementBy(k string, n interface{}, opts CounterOptions) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.addNumber(k, n, false, true, opts)
+}
+
+// DecrementBy 为指定的key减少n并返回新的值，新的值和原来的value类型相同，
+// key不存在时以-n为初始值使用opts.TTL新建一个计数器
+func (c *Cache) DecrementBy(k string, n interface{}, opts CounterOptions) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.addNumber(k, n, true, true, opts)
+}
+
+// addNumber 数字运算的统一实现，negate为true时做减法，create为true时key不存在会新建，外部加写锁
+func (c *Cache) addNumber(k string, n interface{}, negate, create bool, opts CounterOptions) (interface{}, error) {
+	if n == nil || !isNumber(reflect.ValueOf(n)) {
+		return nil, fmt.Errorf("the delta for %s is not a number", k)
+	}
+
+	item, ok := c.lookup(k)
+	if !ok && !create {
+		return nil, fmt.Errorf("item %s not found", k)
+	}
+
+	// 不存在的计数器从n类型的零值开始计算
+	cur := reflect.Zero(reflect.TypeOf(n))
+	if ok {
+		if item.Object == nil || !isNumber(reflect.ValueOf(item.Object)) {
+			return nil, fmt.Errorf("the value for %s can not be increased", k)
+		}
+		cur = reflect.ValueOf(item.Object)
+	}
+
+	var res reflect.Value
+	var err error
+	if isFloat(cur) {
+		res, err = addFloat(cur, reflect.ValueOf(n), negate, opts.Mode)
+	} else {
+		res, err = addInteger(cur, reflect.ValueOf(n), negate, opts.Mode)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", k, err)
+	}
+
+	x := res.Interface()
+	if ok {
+		c.update(k, x)
+	} else {
+		c.add(k, x, opts.TTL)
+	}
+	return x, nil
+}
+
+func isNumber(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return isFloat(v)
+}
+
+func isFloat(v reflect.Value) bool {
+	return v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64
+}
+
+func isUnsigned(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+// toBigInt 把数字无损地转换成整数，带有小数部分的浮点数返回false
+func toBigInt(v reflect.Value) (*big.Int, bool) {
+	switch {
+	case isUnsigned(v):
+		return new(big.Int).SetUint64(v.Uint()), true
+	case isFloat(v):
+		f := v.Float()
+		if math.IsInf(f, 0) || math.IsNaN(f) || f != math.Trunc(f) {
+			return nil, false
+		}
+		i, _ := big.NewFloat(f).Int(nil)
+		return i, true
+	default:
+		return big.NewInt(v.Int()), true
+	}
+}
+
+// intBounds 返回整数类型能表示的范围
+func intBounds(v reflect.Value) (*big.Int, *big.Int) {
+	bits := uint(v.Type().Bits())
+	one := big.NewInt(1)
+	if isUnsigned(v) {
+		max := new(big.Int).Sub(new(big.Int).Lsh(one, bits), one)
+		return big.NewInt(0), max
+	}
+	max := new(big.Int).Sub(new(big.Int).Lsh(one, bits-1), one)
+	min := new(big.Int).Neg(new(big.Int).Lsh(one, bits-1))
+	return min, max
+}
+
+// addInteger 整数的加减法，使用big.Int计算之后再检查是否溢出
+func addInteger(cur, delta reflect.Value, negate bool, mode OverflowMode) (reflect.Value, error) {
+	d, ok := toBigInt(delta)
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("delta %v can not be converted to %s losslessly", delta.Interface(), cur.Type())
+	}
+	c, _ := toBigInt(cur)
+	if negate {
+		d.Neg(d)
+	}
+	r := new(big.Int).Add(c, d)
+
+	min, max := intBounds(cur)
+	zero := big.NewInt(0)
+	switch {
+	case mode == OverflowFloorZero && r.Cmp(zero) < 0:
+		r = zero
+	case r.Cmp(max) > 0:
+		if mode != OverflowSaturate {
+			return reflect.Value{}, fmt.Errorf("%s overflow", cur.Type())
+		}
+		r = max
+	case r.Cmp(min) < 0:
+		if mode != OverflowSaturate {
+			return reflect.Value{}, fmt.Errorf("%s underflow", cur.Type())
+		}
+		r = min
+	}
+
+	res := reflect.New(cur.Type()).Elem()
+	if isUnsigned(cur) {
+		res.SetUint(r.Uint64())
+	} else {
+		res.SetInt(r.Int64())
+	}
+	return res, nil
+}
+
+// toFloat 把数字无损地转换成指定位数的浮点数
+func toFloat(v reflect.Value, bits int) (float64, bool) {
+	var f float64
+	switch {
+	case isFloat(v):
+		f = v.Float()
+	case isUnsigned(v):
+		f = float64(v.Uint())
+		if f >= math.MaxUint64 || uint64(f) != v.Uint() {
+			return 0, false
+		}
+	default:
+		f = float64(v.Int())
+		if f >= math.MaxInt64 || int64(f) != v.Int() {
+			return 0, false
+		}
+	}
+	if bits == 32 && float64(float32(f)) != f {
+		return 0, false
+	}
+	return f, true
+}
+
+// addFloat 浮点数的加减法，结果超出类型能表示的范围时视为溢出，
+// float32的结果必须能无损保存，delta和结果都不能是NaN
+func addFloat(cur, delta reflect.Value, negate bool, mode OverflowMode) (reflect.Value, error) {
+	bits := cur.Type().Bits()
+	d, ok := toFloat(delta, bits)
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("delta %v can not be converted to %s losslessly", delta.Interface(), cur.Type())
+	}
+	if math.IsNaN(d) {
+		return reflect.Value{}, fmt.Errorf("delta is not a number")
+	}
+	if negate {
+		d = -d
+	}
+	r := cur.Float() + d
+	if math.IsNaN(r) {
+		return reflect.Value{}, fmt.Errorf("the result is not a number")
+	}
+
+	max := math.MaxFloat64
+	if bits == 32 {
+		max = math.MaxFloat32
+	}
+	switch {
+	case mode == OverflowFloorZero && r < 0:
+		r = 0
+	case r > max:
+		if mode != OverflowSaturate {
+			return reflect.Value{}, fmt.Errorf("%s overflow", cur.Type())
+		}
+		r = max
+	case r < -max:
+		if mode != OverflowSaturate {
+			return reflect.Value{}, fmt.Errorf("%s underflow", cur.Type())
+		}
+		r = -max
+	}
+	if bits == 32 && float64(float32(r)) != r {
+		return reflect.Value{}, fmt.Errorf("the result %v can not be stored in %s losslessly", r, cur.Type())
+	}
+
+	res := reflect.New(cur.Type()).Elem()
+	res.SetFloat(r)
+	return res, nil
+}
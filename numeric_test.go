@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIncrement(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	// 不同宽度的delta可以无损转换
+	c.Set("i64", int64(10), NoExpiration)
+	v, err := c.Increment("i64", 5)
+	require.NoError(t, err)
+	require.Equal(t, int64(15), v)
+	v, err = c.Decrement("i64", 2.0)
+	require.NoError(t, err)
+	require.Equal(t, int64(13), v)
+	_, err = c.Increment("i64", 0.5)
+	require.Error(t, err)
+
+	c.Set("f32", float32(1.5), NoExpiration)
+	v, err = c.Increment("f32", 1)
+	require.NoError(t, err)
+	require.Equal(t, float32(2.5), v)
+	_, err = c.Increment("f32", 0.1)
+	require.Error(t, err)
+
+	// float32保存不下的结果和NaN都会被拒绝，原来的值不变
+	c.Set("f32", float32(16777216), NoExpiration)
+	_, err = c.Increment("f32", 1)
+	require.Error(t, err)
+	v, _ = c.Get("f32")
+	require.Equal(t, float32(16777216), v)
+	v, err = c.Increment("f32", 2)
+	require.NoError(t, err)
+	require.Equal(t, float32(16777218), v)
+	_, err = c.Increment("f32", math.NaN())
+	require.Error(t, err)
+	c.Set("f64", 1.5, NoExpiration)
+	_, err = c.Increment("f64", math.NaN())
+	require.Error(t, err)
+	c.Set("inf", math.Inf(1), NoExpiration)
+	_, err = c.IncrementBy("inf", math.Inf(-1), CounterOptions{Mode: OverflowSaturate})
+	require.Error(t, err)
+	v, _ = c.Get("f64")
+	require.Equal(t, 1.5, v)
+
+	_, err = c.Increment("missing", 1)
+	require.Error(t, err)
+	_, err = c.Decrement("missing", 1)
+	require.Error(t, err)
+
+	c.Set("str", "a", NoExpiration)
+	_, err = c.Increment("str", 1)
+	require.Error(t, err)
+}
+
+func TestIncrementOverflow(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	c.Set("i8", int8(120), NoExpiration)
+	_, err := c.Increment("i8", 10)
+	require.Error(t, err)
+	v, _ := c.Get("i8")
+	require.Equal(t, int8(120), v)
+
+	v, err = c.IncrementBy("i8", 10, CounterOptions{Mode: OverflowSaturate})
+	require.NoError(t, err)
+	require.Equal(t, int8(math.MaxInt8), v)
+
+	c.Set("u", uint(3), NoExpiration)
+	_, err = c.Decrement("u", 5)
+	require.Error(t, err)
+	v, err = c.DecrementBy("u", 5, CounterOptions{Mode: OverflowFloorZero})
+	require.NoError(t, err)
+	require.Equal(t, uint(0), v)
+
+	c.Set("u64", uint64(math.MaxUint64), NoExpiration)
+	_, err = c.Increment("u64", 1)
+	require.Error(t, err)
+
+	c.Set("f", math.MaxFloat64, NoExpiration)
+	_, err = c.Increment("f", math.MaxFloat64)
+	require.Error(t, err)
+}
+
+func TestIncrementCreate(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	v, err := c.IncrementBy("counter", int64(3), CounterOptions{TTL: time.Millisecond})
+	require.NoError(t, err)
+	require.Equal(t, int64(3), v)
+	v, _ = c.IncrementBy("counter", 1, CounterOptions{})
+	require.Equal(t, int64(4), v)
+
+	time.Sleep(2 * time.Millisecond)
+	v, _ = c.DecrementBy("counter", 1, CounterOptions{})
+	require.Equal(t, -1, v)
+
+	v, err = c.DecrementBy("floor", uint8(1), CounterOptions{Mode: OverflowFloorZero})
+	require.NoError(t, err)
+	require.Equal(t, uint8(0), v)
+}
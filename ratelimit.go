@@ -0,0 +1,254 @@
+package cache
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// LimitAlgorithm 限流算法
+type LimitAlgorithm int
+
+const (
+	FixedWindow          LimitAlgorithm = iota // 固定窗口计数，窗口边界上可能出现两倍的突发
+	SlidingWindowLog                           // 滑动窗口日志，精确但是每个请求都要记录时间
+	SlidingWindowCounter                       // 滑动窗口计数，用上一个窗口的计数按比例估计
+	TokenBucket                                // 令牌桶，每个窗口补充limit个令牌，最多积攒limit个
+)
+
+// String 返回限流算法的名字
+func (a LimitAlgorithm) String() string {
+	switch a {
+	case FixedWindow:
+		return "fixed window"
+	case SlidingWindowLog:
+		return "sliding window log"
+	case SlidingWindowCounter:
+		return "sliding window counter"
+	case TokenBucket:
+		return "token bucket"
+	}
+	return fmt.Sprintf("LimitAlgorithm(%d)", int(a))
+}
+
+// LimitResult 一次限流判断的结果
+type LimitResult struct {
+	Allowed    bool          // 是否允许通过
+	Remaining  int           // 当前窗口剩余的配额
+	RetryAfter time.Duration // 被拒绝时至少需要等待多久再重试
+}
+
+// Limiter 限流器，状态作为普通的key保存在cache里，过期之后由gc自动清理
+type Limiter struct {
+	c         *Cache
+	algorithm LimitAlgorithm
+}
+
+// fixedWindowState 固定窗口的状态
+type fixedWindowState struct {
+	Start int64 // 当前窗口的起始时间
+	Count int   // 当前窗口的请求数
+}
+
+// slidingLogState 滑动窗口日志的状态
+type slidingLogState struct {
+	Times []int64 // 窗口内每个请求的时间，从旧到新排序
+}
+
+// slidingCounterState 滑动窗口计数的状态
+type slidingCounterState struct {
+	Start int64 // 当前窗口的起始时间
+	Prev  int   // 上一个窗口的请求数
+	Curr  int   // 当前窗口的请求数
+}
+
+// tokenBucketState 令牌桶的状态
+type tokenBucketState struct {
+	Tokens float64 // 剩余的令牌数
+	Last   int64   // 上一次计算令牌的时间
+}
+
+// NewLimiter 新建一个使用指定算法的限流器
+func (c *Cache) NewLimiter(algorithm LimitAlgorithm) *Limiter {
+	return &Limiter{c: c, algorithm: algorithm}
+}
+
+// Allow 判断key在window时间内最多limit次的限制下能否再通过一次
+func (l *Limiter) Allow(k string, limit int, window time.Duration) (LimitResult, error) {
+	return l.AllowN(k, limit, window, 1)
+}
+
+// AllowN 判断key在window时间内最多limit次的限制下能否再通过n次，不能通过时不消耗配额
+func (l *Limiter) AllowN(k string, limit int, window time.Duration, n int) (LimitResult, error) {
+	if limit <= 0 || window <= 0 || n <= 0 {
+		return LimitResult{}, fmt.Errorf("limit, window and n must be positive")
+	}
+	if n > limit {
+		return LimitResult{}, fmt.Errorf("n %d exceeds limit %d", n, limit)
+	}
+
+	c := l.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var state interface{}
+	if item, ok := c.lookup(k); ok {
+		state = item.Object
+	}
+
+	now, w := time.Now().UnixNano(), int64(window)
+	switch l.algorithm {
+	case FixedWindow:
+		return c.fixedWindow(k, state, now, w, limit, n)
+	case SlidingWindowLog:
+		return c.slidingLog(k, state, now, w, limit, n)
+	case SlidingWindowCounter:
+		return c.slidingCounter(k, state, now, w, limit, n)
+	case TokenBucket:
+		return c.tokenBucket(k, state, now, w, limit, n)
+	}
+	return LimitResult{}, fmt.Errorf("unknown limit algorithm %d", l.algorithm)
+}
+
+// limitState 检查key原来的状态类型是否和限流算法一致
+func limitState(k string, algorithm LimitAlgorithm, state interface{}, ok bool) error {
+	if state != nil && !ok {
+		return fmt.Errorf("the value for %s is not a %s limiter state", k, algorithm)
+	}
+	return nil
+}
+
+func (c *Cache) fixedWindow(k string, state interface{}, now, w int64, limit, n int) (LimitResult, error) {
+	s, ok := state.(*fixedWindowState)
+	if err := limitState(k, FixedWindow, state, ok); err != nil {
+		return LimitResult{}, err
+	}
+	// 状态在副本上修改，Items和Snapshot返回的状态可能还在被读取
+	start := now - now%w
+	if !ok || s.Start != start {
+		s = &fixedWindowState{Start: start}
+	} else {
+		cp := *s
+		s = &cp
+	}
+
+	res := LimitResult{}
+	if s.Count+n <= limit {
+		s.Count += n
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration(start + w - now)
+	}
+	res.Remaining = limit - s.Count
+	c.put(k, s, time.Duration(start+w-now))
+	return res, nil
+}
+
+func (c *Cache) slidingLog(k string, state interface{}, now, w int64, limit, n int) (LimitResult, error) {
+	s, ok := state.(*slidingLogState)
+	if err := limitState(k, SlidingWindowLog, state, ok); err != nil {
+		return LimitResult{}, err
+	}
+	if !ok {
+		s = &slidingLogState{}
+	}
+
+	// 丢弃已经滑出窗口的请求，剩下的复制到新的状态里再修改
+	i := 0
+	for i < len(s.Times) && s.Times[i] <= now-w {
+		i++
+	}
+	times := make([]int64, len(s.Times)-i, len(s.Times)-i+n)
+	copy(times, s.Times[i:])
+	s = &slidingLogState{Times: times}
+
+	res := LimitResult{}
+	if len(s.Times)+n <= limit {
+		for j := 0; j < n; j++ {
+			s.Times = append(s.Times, now)
+		}
+		res.Allowed = true
+	} else {
+		// 等到足够多的旧请求滑出窗口
+		res.RetryAfter = time.Duration(s.Times[len(s.Times)+n-limit-1] + w - now)
+	}
+	res.Remaining = limit - len(s.Times)
+	if len(s.Times) == 0 {
+		return res, nil
+	}
+	c.put(k, s, time.Duration(s.Times[len(s.Times)-1]+w-now))
+	return res, nil
+}
+
+func (c *Cache) slidingCounter(k string, state interface{}, now, w int64, limit, n int) (LimitResult, error) {
+	s, ok := state.(*slidingCounterState)
+	if err := limitState(k, SlidingWindowCounter, state, ok); err != nil {
+		return LimitResult{}, err
+	}
+	// 状态在副本上修改，Items和Snapshot返回的状态可能还在被读取
+	start := now - now%w
+	switch {
+	case !ok:
+		s = &slidingCounterState{Start: start}
+	case s.Start == start-w:
+		s = &slidingCounterState{Start: start, Prev: s.Curr}
+	case s.Start != start:
+		s = &slidingCounterState{Start: start}
+	default:
+		cp := *s
+		s = &cp
+	}
+
+	// 上一个窗口还在滑动窗口内的比例
+	weight := float64(w-(now-start)) / float64(w)
+	estimate := float64(s.Prev)*weight + float64(s.Curr)
+
+	res := LimitResult{}
+	if estimate+float64(n) <= float64(limit) {
+		s.Curr += n
+		estimate += float64(n)
+		res.Allowed = true
+	} else if room := limit - s.Curr - n; room >= 0 {
+		// 上一个窗口的权重线性下降，求出估计值降到允许通过的时间点
+		t := start + w - int64(math.Floor(float64(room)*float64(w)/float64(s.Prev)))
+		res.RetryAfter = time.Duration(t - now)
+	} else {
+		// 当前窗口已经不够了，到下一个窗口时当前窗口的计数变成上一个窗口的计数
+		t := start + w + int64(math.Ceil(float64(w)*(1-float64(limit-n)/float64(s.Curr))))
+		res.RetryAfter = time.Duration(t - now)
+	}
+	res.Remaining = int(math.Max(0, math.Floor(float64(limit)-estimate)))
+	c.put(k, s, time.Duration(start+2*w-now))
+	return res, nil
+}
+
+func (c *Cache) tokenBucket(k string, state interface{}, now, w int64, limit, n int) (LimitResult, error) {
+	s, ok := state.(*tokenBucketState)
+	if err := limitState(k, TokenBucket, state, ok); err != nil {
+		return LimitResult{}, err
+	}
+	// 状态在副本上修改，Items和Snapshot返回的状态可能还在被读取
+	rate := float64(limit) / float64(w)
+	if !ok {
+		s = &tokenBucketState{Tokens: float64(limit), Last: now}
+	} else {
+		cp := *s
+		s = &cp
+	}
+	s.Tokens = math.Min(float64(limit), s.Tokens+float64(now-s.Last)*rate)
+	s.Last = now
+
+	res := LimitResult{}
+	if s.Tokens >= float64(n) {
+		s.Tokens -= float64(n)
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration(math.Ceil((float64(n) - s.Tokens) / rate))
+	}
+	res.Remaining = int(s.Tokens)
+
+	// 令牌补满之后和没有状态是一样的，可以过期
+	full := time.Duration(math.Ceil((float64(limit)-s.Tokens)/rate)) + 1
+	c.put(k, s, full)
+	return res, nil
+}
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	for _, alg := range []LimitAlgorithm{FixedWindow, SlidingWindowLog, SlidingWindowCounter, TokenBucket} {
+		l := c.NewLimiter(alg)
+		k := fmt.Sprintf("limit%d", alg)
+		for i := 0; i < 5; i++ {
+			res, err := l.Allow(k, 5, time.Hour)
+			require.NoError(t, err)
+			require.True(t, res.Allowed, "algorithm %d request %d", alg, i)
+			require.Equal(t, 4-i, res.Remaining)
+		}
+		res, err := l.Allow(k, 5, time.Hour)
+		require.NoError(t, err)
+		require.False(t, res.Allowed, "algorithm %d", alg)
+		require.Greater(t, res.RetryAfter, time.Duration(0))
+		require.LessOrEqual(t, res.RetryAfter, 2*time.Hour)
+
+		_, err = l.AllowN(k, 5, time.Hour, 6)
+		require.Error(t, err)
+	}
+
+	// 不同算法不能共用一个key
+	_, err := c.NewLimiter(TokenBucket).Allow("limit0", 5, time.Hour)
+	require.EqualError(t, err, "the value for limit0 is not a token bucket limiter state")
+	c.Set("str", "a", DefaultExpiration)
+	_, err = c.NewLimiter(FixedWindow).Allow("str", 5, time.Hour)
+	require.EqualError(t, err, "the value for str is not a fixed window limiter state")
+}
+
+func TestLimiterRecover(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	for _, alg := range []LimitAlgorithm{FixedWindow, SlidingWindowLog, SlidingWindowCounter, TokenBucket} {
+		l := c.NewLimiter(alg)
+		k := fmt.Sprintf("recover%d", alg)
+		res, _ := l.AllowN(k, 2, 20*time.Millisecond, 2)
+		require.True(t, res.Allowed)
+		res, _ = l.Allow(k, 2, 20*time.Millisecond)
+		require.False(t, res.Allowed)
+
+		time.Sleep(res.RetryAfter + time.Millisecond)
+		res, _ = l.Allow(k, 2, 20*time.Millisecond)
+		require.True(t, res.Allowed, "algorithm %d", alg)
+	}
+}
+
+func TestLimiterSnapshot(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	// 限流状态在副本上修改，快照里的状态不变
+	for _, alg := range []LimitAlgorithm{FixedWindow, SlidingWindowLog, SlidingWindowCounter, TokenBucket} {
+		l := c.NewLimiter(alg)
+		k := fmt.Sprintf("snap%d", alg)
+		_, err := l.Allow(k, 5, time.Hour)
+		require.NoError(t, err)
+		s := c.Snapshot()
+		before, _ := s.Get(k)
+		want := fmt.Sprintf("%+v", before)
+		_, err = l.AllowN(k, 5, time.Hour, 3)
+		require.NoError(t, err)
+		after, _ := s.Get(k)
+		require.Equal(t, want, fmt.Sprintf("%+v", after), "algorithm %v", alg)
+	}
+}
@@ -0,0 +1,163 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+)
+
+// semaphore 计数信号量，每个许可单独过期，持有者崩溃之后泄漏的许可会在gc时回收，
+// 许可的总数由每次调用传入，不需要保存
+type semaphore struct {
+	Permits map[string]int64 // 已经发出的许可 -> 过期时间
+}
+
+// clone 复制信号量，修改之前必须复制，Get和Snapshot返回的信号量可能还在被读取
+func (s *semaphore) clone() *semaphore {
+	n := &semaphore{Permits: make(map[string]int64, len(s.Permits))}
+	for token, e := range s.Permits {
+		n.Permits[token] = e
+	}
+	return n
+}
+
+// prune 原地回收过期的许可，只能用于复制出来的信号量
+func (s *semaphore) prune(now int64) {
+	for token, e := range s.Permits {
+		if now > e {
+			delete(s.Permits, token)
+		}
+	}
+}
+
+// sweep 返回回收过期许可之后的副本，没有过期的许可时返回nil
+func (s *semaphore) sweep(now int64) (interface{}, bool) {
+	for _, e := range s.Permits {
+		if now > e {
+			n := s.clone()
+			n.prune(now)
+			return n, len(n.Permits) == 0
+		}
+	}
+	return nil, len(s.Permits) == 0
+}
+
+// lastExpiration 返回最晚过期的许可的过期时间
+func (s *semaphore) lastExpiration() int64 {
+	var last int64
+	for _, e := range s.Permits {
+		if e > last {
+			last = e
+		}
+	}
+	return last
+}
+
+// getSemaphore 获取key对应的信号量，信号量不存在或者已经过期时返回false，外部加锁
+func (c *Cache) getSemaphore(name string) (*semaphore, bool, error) {
+	item, ok := c.lookup(name)
+	if !ok {
+		return nil, false, nil
+	}
+	s, ok := item.Object.(*semaphore)
+	if !ok {
+		return nil, false, fmt.Errorf("the value for %s is not a semaphore", name)
+	}
+	return s, true, nil
+}
+
+// putSemaphore 保存信号量，key的过期时间和最晚过期的许可一致，外部加写锁。
+// 没有许可时直接删除这个key，空闲的信号量和不存在的信号量是一样的，不需要记录到delMap
+func (c *Cache) putSemaphore(name string, s *semaphore) {
+	if len(s.Permits) == 0 {
+		c.removeItem(name)
+		c.indexDelete(name)
+		return
+	}
+	c.put(name, s, time.Until(time.Unix(0, s.lastExpiration())))
+}
+
+// Acquire 从总数为permits的信号量中获取一个许可，返回许可的凭证，
+// 许可在ttl之后自动过期，没有可用的许可时返回错误，permits和之前不同时以这次为准
+func (c *Cache) Acquire(name string, permits int, ttl time.Duration) (string, error) {
+	if permits <= 0 || ttl <= 0 {
+		return "", fmt.Errorf("permits and ttl must be positive")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok, err := c.getSemaphore(name)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		s = s.clone()
+	} else {
+		s = &semaphore{Permits: make(map[string]int64)}
+	}
+	s.prune(time.Now().UnixNano())
+	if len(s.Permits) >= permits {
+		return "", fmt.Errorf("semaphore %s has no available permits", name)
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	s.Permits[token] = time.Now().Add(ttl).UnixNano()
+	c.putSemaphore(name, s)
+	return token, nil
+}
+
+// Release 归还一个许可，许可已经过期或者不存在时返回错误
+func (c *Cache) Release(name, token string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok, err := c.getSemaphore(name)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("semaphore %s not found", name)
+	}
+	s = s.clone()
+	s.prune(time.Now().UnixNano())
+	if _, ok := s.Permits[token]; !ok {
+		return fmt.Errorf("permit %s of semaphore %s not found", token, name)
+	}
+	delete(s.Permits, token)
+	c.putSemaphore(name, s)
+	return nil
+}
+
+// Available 返回总数为permits的信号量当前可用的许可数量，
+// 和Acquire一样以传入的permits为准，信号量不存在或者空闲时返回permits
+func (c *Cache) Available(name string, permits int) (int, error) {
+	if permits <= 0 {
+		return 0, fmt.Errorf("permits must be positive")
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	s, ok, err := c.getSemaphore(name)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return permits, nil
+	}
+
+	now := time.Now().UnixNano()
+	used := 0
+	for _, e := range s.Permits {
+		if now <= e {
+			used++
+		}
+	}
+	if used > permits {
+		return 0, nil
+	}
+	return permits - used, nil
+}
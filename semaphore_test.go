@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSemaphore(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	n, err := c.Available("sem", 2)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	_, err = c.Acquire("sem", 0, time.Minute)
+	require.Error(t, err)
+	_, err = c.Acquire("sem", 2, 0)
+	require.Error(t, err)
+
+	// 许可用完之后获取失败
+	t1, err := c.Acquire("sem", 2, time.Minute)
+	require.NoError(t, err)
+	t2, err := c.Acquire("sem", 2, time.Minute)
+	require.NoError(t, err)
+	require.NotEqual(t, t1, t2)
+	_, err = c.Acquire("sem", 2, time.Minute)
+	require.Error(t, err)
+	n, _ = c.Available("sem", 2)
+	require.Equal(t, 0, n)
+	// 总数以这次传入的为准
+	n, _ = c.Available("sem", 3)
+	require.Equal(t, 1, n)
+	n, _ = c.Available("sem", 1)
+	require.Equal(t, 0, n)
+
+	require.Error(t, c.Release("sem", "other"))
+	require.Error(t, c.Release("missing", t1))
+	require.NoError(t, c.Release("sem", t1))
+	require.Error(t, c.Release("sem", t1))
+	n, _ = c.Available("sem", 2)
+	require.Equal(t, 1, n)
+
+	// 所有许可都归还之后信号量是空闲的，不是错误，也不会记录到delMap
+	require.NoError(t, c.Release("sem", t2))
+	n, err = c.Available("sem", 2)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.False(t, c.SearchDel("sem"))
+
+	c.Set("str", "a", DefaultExpiration)
+	_, err = c.Acquire("str", 1, time.Minute)
+	require.Error(t, err)
+	_, err = c.Available("str", 1)
+	require.Error(t, err)
+
+	// 获取和归还都写到副本里，快照中的信号量不变
+	t3, err := c.Acquire("iso", 2, time.Minute)
+	require.NoError(t, err)
+	v, _ := c.Snapshot().Get("iso")
+	_, err = c.Acquire("iso", 2, time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, c.Release("iso", t3))
+	require.Len(t, v.(*semaphore).Permits, 1)
+	require.Contains(t, v.(*semaphore).Permits, t3)
+}
+
+func TestSemaphoreExpiration(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	// 过期的许可不占用总数，也不能再归还
+	short, err := c.Acquire("sem", 2, time.Millisecond)
+	require.NoError(t, err)
+	long, err := c.Acquire("sem", 2, time.Minute)
+	require.NoError(t, err)
+	time.Sleep(2 * time.Millisecond)
+	n, err := c.Available("sem", 2)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Error(t, c.Release("sem", short))
+	_, err = c.Acquire("sem", 2, time.Millisecond)
+	require.NoError(t, err)
+
+	// gc回收过期的许可，没有许可时删除这个key
+	time.Sleep(2 * time.Millisecond)
+	c.delete()
+	c.mu.RLock()
+	require.Len(t, c.items["sem"].Object.(*semaphore).Permits, 1)
+	c.mu.RUnlock()
+	require.NoError(t, c.Release("sem", long))
+	require.False(t, c.IsExistedKey("sem"))
+
+	_, err = c.Acquire("leak", 1, time.Millisecond)
+	require.NoError(t, err)
+	time.Sleep(2 * time.Millisecond)
+	c.delete()
+	require.False(t, c.IsExistedKey("leak"))
+	n, _ = c.Available("leak", 1)
+	require.Equal(t, 1, n)
+}
@@ -0,0 +1,294 @@
+package cache
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// Set 集合类型的value，成员都是字符串
+type Set map[string]bool
+
+// members 按字典序返回集合的所有成员
+func (s Set) members() []string {
+	res := make([]string, 0, len(s))
+	for m := range s {
+		res = append(res, m)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// clone 复制集合，修改之前必须复制，Get和Snapshot返回的集合可能还在被读取
+func (s Set) clone() Set {
+	n := make(Set, len(s))
+	for m := range s {
+		n[m] = true
+	}
+	return n
+}
+
+// getSet 获取key对应的集合，key不存在或者已经过期时返回false，外部加锁
+func (c *Cache) getSet(k string) (Set, bool, error) {
+	item, ok := c.lookup(k)
+	if !ok {
+		return nil, false, nil
+	}
+	s, ok := item.Object.(Set)
+	if !ok {
+		return nil, false, fmt.Errorf("the value for %s is not a set", k)
+	}
+	return s, true, nil
+}
+
+// putSet 修改完成之后同步索引，集合为空时删除这个key，外部加写锁
+func (c *Cache) putSet(k string, s Set) {
+	if len(s) == 0 {
+		c.manualDelete(k)
+		return
+	}
+	c.update(k, s)
+}
+
+// storeSet 用集合覆盖dst原来的数据，集合为空时删除dst，外部加写锁
+func (c *Cache) storeSet(dst string, s Set) {
+	if len(s) > 0 {
+		c.put(dst, s, DefaultExpiration)
+	} else if _, ok := c.lookup(dst); ok {
+		c.manualDelete(dst)
+	}
+}
+
+// combine 对多个集合做交集、并集或者差集，不存在的key当作空集合，外部加锁
+func (c *Cache) combine(op string, keys []string) (Set, error) {
+	sets := make([]Set, len(keys))
+	for i, k := range keys {
+		s, _, err := c.getSet(k)
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = s
+	}
+
+	res := make(Set)
+	if len(sets) == 0 {
+		return res, nil
+	}
+	switch op {
+	case "inter":
+		for m := range sets[0] {
+			in := true
+			for _, s := range sets[1:] {
+				if !s[m] {
+					in = false
+					break
+				}
+			}
+			if in {
+				res[m] = true
+			}
+		}
+	case "union":
+		for _, s := range sets {
+			for m := range s {
+				res[m] = true
+			}
+		}
+	case "diff":
+		for m := range sets[0] {
+			in := false
+			for _, s := range sets[1:] {
+				if s[m] {
+					in = true
+					break
+				}
+			}
+			if !in {
+				res[m] = true
+			}
+		}
+	}
+	return res, nil
+}
+
+// SAdd 向集合中加入成员，返回新加入的数量，key不存在时使用默认过期时间新建一个集合
+func (c *Cache) SAdd(k string, members ...string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok, err := c.getSet(k)
+	if err != nil {
+		return 0, err
+	}
+	s = s.clone()
+	n := 0
+	for _, m := range members {
+		if !s[m] {
+			s[m] = true
+			n++
+		}
+	}
+	if !ok {
+		if n > 0 {
+			c.add(k, s, DefaultExpiration)
+		}
+		return n, nil
+	}
+	c.putSet(k, s)
+	return n, nil
+}
+
+// SRem 删除集合中的成员，返回删除的数量，集合为空时删除这个key
+func (c *Cache) SRem(k string, members ...string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok, err := c.getSet(k)
+	if err != nil || !ok {
+		return 0, err
+	}
+	s = s.clone()
+	n := 0
+	for _, m := range members {
+		if s[m] {
+			delete(s, m)
+			n++
+		}
+	}
+	c.putSet(k, s)
+	return n, nil
+}
+
+// SIsMember 判断member是否在集合中
+func (c *Cache) SIsMember(k, member string) (bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	s, _, err := c.getSet(k)
+	return s[member], err
+}
+
+// SMembers 按字典序返回集合的所有成员
+func (c *Cache) SMembers(k string) ([]string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	s, _, err := c.getSet(k)
+	if err != nil {
+		return nil, err
+	}
+	return s.members(), nil
+}
+
+// SCard 返回集合的成员数量，key不存在时返回0
+func (c *Cache) SCard(k string) (int, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	s, _, err := c.getSet(k)
+	return len(s), err
+}
+
+// SPop 随机取出并删除集合中的一个成员，集合为空或者不存在时返回false
+func (c *Cache) SPop(k string) (string, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok, err := c.getSet(k)
+	if err != nil || !ok {
+		return "", false, err
+	}
+	// map的遍历顺序不是均匀随机的，所以随机选一个下标再遍历过去
+	var m string
+	i := rand.Intn(len(s))
+	for m = range s {
+		if i == 0 {
+			break
+		}
+		i--
+	}
+	s = s.clone()
+	delete(s, m)
+	c.putSet(k, s)
+	return m, true, nil
+}
+
+// SRandMember 随机返回集合中的成员，不会删除，
+// count大于0时返回最多count个不重复的成员，小于0时返回-count个可能重复的成员
+func (c *Cache) SRandMember(k string, count int) ([]string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	s, _, err := c.getSet(k)
+	if err != nil || len(s) == 0 {
+		return []string{}, err
+	}
+	members := s.members()
+	if count < 0 {
+		res := make([]string, -count)
+		for i := range res {
+			res[i] = members[rand.Intn(len(members))]
+		}
+		return res, nil
+	}
+	rand.Shuffle(len(members), func(i, j int) {
+		members[i], members[j] = members[j], members[i]
+	})
+	if count < len(members) {
+		members = members[:count]
+	}
+	return members, nil
+}
+
+// SInter 返回多个集合的交集
+func (c *Cache) SInter(keys ...string) ([]string, error) {
+	return c.setOp("inter", keys)
+}
+
+// SUnion 返回多个集合的并集
+func (c *Cache) SUnion(keys ...string) ([]string, error) {
+	return c.setOp("union", keys)
+}
+
+// SDiff 返回第一个集合与其余集合的差集
+func (c *Cache) SDiff(keys ...string) ([]string, error) {
+	return c.setOp("diff", keys)
+}
+
+// SInterStore 把多个集合的交集保存到dst，返回结果的成员数量
+func (c *Cache) SInterStore(dst string, keys ...string) (int, error) {
+	return c.setOpStore("inter", dst, keys)
+}
+
+// SUnionStore 把多个集合的并集保存到dst，返回结果的成员数量
+func (c *Cache) SUnionStore(dst string, keys ...string) (int, error) {
+	return c.setOpStore("union", dst, keys)
+}
+
+// SDiffStore 把第一个集合与其余集合的差集保存到dst，返回结果的成员数量
+func (c *Cache) SDiffStore(dst string, keys ...string) (int, error) {
+	return c.setOpStore("diff", dst, keys)
+}
+
+func (c *Cache) setOp(op string, keys []string) ([]string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	s, err := c.combine(op, keys)
+	if err != nil {
+		return nil, err
+	}
+	return s.members(), nil
+}
+
+func (c *Cache) setOpStore(op, dst string, keys []string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, err := c.combine(op, keys)
+	if err != nil {
+		return 0, err
+	}
+	c.storeSet(dst, s)
+	return len(s), nil
+}
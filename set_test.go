@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetOps(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	n, err := c.SAdd("a", "x", "y", "z", "x")
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	n, err = c.SAdd("b", "y", "z", "w")
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	n, err = c.SAdd("empty")
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+	require.False(t, c.IsExistedKey("empty"))
+
+	ok, err := c.SIsMember("a", "x")
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = c.SIsMember("missing", "x")
+	require.NoError(t, err)
+	require.False(t, ok)
+	members, err := c.SMembers("a")
+	require.NoError(t, err)
+	require.Equal(t, []string{"x", "y", "z"}, members)
+
+	res, err := c.SInter("a", "b")
+	require.NoError(t, err)
+	require.Equal(t, []string{"y", "z"}, res)
+	res, err = c.SUnion("a", "b", "missing")
+	require.NoError(t, err)
+	require.Equal(t, []string{"w", "x", "y", "z"}, res)
+	res, err = c.SDiff("a", "b")
+	require.NoError(t, err)
+	require.Equal(t, []string{"x"}, res)
+
+	n, err = c.SInterStore("dst", "a", "b")
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	members, _ = c.SMembers("dst")
+	require.Equal(t, []string{"y", "z"}, members)
+	n, err = c.SUnionStore("dst", "a", "b")
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+	n, err = c.SDiffStore("dst", "a", "b")
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	members, _ = c.SMembers("dst")
+	require.Equal(t, []string{"x"}, members)
+	// 结果为空时删除dst
+	n, err = c.SInterStore("dst", "a", "missing")
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+	require.False(t, c.IsExistedKey("dst"))
+
+	// count为正数时不重复，为负数时可能重复
+	rnd, err := c.SRandMember("a", 2)
+	require.NoError(t, err)
+	require.Len(t, rnd, 2)
+	require.NotEqual(t, rnd[0], rnd[1])
+	rnd, err = c.SRandMember("a", 10)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"x", "y", "z"}, rnd)
+	rnd, err = c.SRandMember("a", -10)
+	require.NoError(t, err)
+	require.Len(t, rnd, 10)
+	for _, m := range rnd {
+		require.Contains(t, []string{"x", "y", "z"}, m)
+	}
+	rnd, err = c.SRandMember("missing", -3)
+	require.NoError(t, err)
+	require.Empty(t, rnd)
+
+	n, err = c.SRem("a", "x", "missing")
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	seen := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		m, ok, err := c.SPop("a")
+		require.NoError(t, err)
+		require.True(t, ok)
+		seen[m] = true
+	}
+	require.Equal(t, map[string]bool{"y": true, "z": true}, seen)
+	_, ok, err = c.SPop("a")
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.False(t, c.IsExistedKey("a"))
+
+	c.Set("str", "v", DefaultExpiration)
+	_, err = c.SAdd("str", "x")
+	require.Error(t, err)
+	_, err = c.SUnion("b", "str")
+	require.Error(t, err)
+}
+
+func TestSetCopyOnWrite(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	_, err := c.SAdd("s", "a", "b")
+	require.NoError(t, err)
+	v, _ := c.Get("s")
+	held := v.(Set)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			_, _ = c.SAdd("s", "c")
+			_, _ = c.SRem("s", "a")
+			_, _, _ = c.SPop("s")
+			_, _ = c.SAdd("s", "a", "b")
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		_ = held["a"]
+	}
+	wg.Wait()
+	require.Equal(t, Set{"a": true, "b": true}, held)
+}
@@ -0,0 +1,225 @@
+package cache
+
+import "math/rand"
+
+const (
+	skiplistMaxLevel = 32   // 跳表的最大层数
+	skiplistP        = 0.25 // 每升高一层的概率
+)
+
+// skiplistLevel 跳表节点的一层，span记录到下一个节点跨过的节点数，用于计算排名
+type skiplistLevel struct {
+	forward *skiplistNode
+	span    int
+}
+
+type skiplistNode struct {
+	member   string
+	score    float64
+	backward *skiplistNode
+	level    []skiplistLevel
+}
+
+// skiplist 按照score和member排序的跳表，排名从1开始
+type skiplist struct {
+	header *skiplistNode
+	tail   *skiplistNode
+	length int
+	level  int
+}
+
+func newSkiplist() *skiplist {
+	return &skiplist{
+		header: &skiplistNode{level: make([]skiplistLevel, skiplistMaxLevel)},
+		level:  1,
+	}
+}
+
+func randomLevel() int {
+	lvl := 1
+	for lvl < skiplistMaxLevel && rand.Float64() < skiplistP {
+		lvl++
+	}
+	return lvl
+}
+
+// before 判断节点是否排在(score, member)之前
+func (n *skiplistNode) before(score float64, member string) bool {
+	return n.score < score || (n.score == score && n.member < member)
+}
+
+// after 判断节点是否排在(score, member)之后
+func (n *skiplistNode) after(score float64, member string) bool {
+	return n.score > score || (n.score == score && n.member > member)
+}
+
+// insert 插入一个节点，调用方保证member不存在
+func (zsl *skiplist) insert(score float64, member string) *skiplistNode {
+	var update [skiplistMaxLevel]*skiplistNode
+	var rank [skiplistMaxLevel]int
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		if i != zsl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.level[i].forward != nil && x.level[i].forward.before(score, member) {
+			rank[i] += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	lvl := randomLevel()
+	if lvl > zsl.level {
+		for i := zsl.level; i < lvl; i++ {
+			rank[i] = 0
+			update[i] = zsl.header
+			update[i].level[i].span = zsl.length
+		}
+		zsl.level = lvl
+	}
+
+	x = &skiplistNode{member: member, score: score, level: make([]skiplistLevel, lvl)}
+	for i := 0; i < lvl; i++ {
+		x.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = x
+		x.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = rank[0] - rank[i] + 1
+	}
+	for i := lvl; i < zsl.level; i++ {
+		update[i].level[i].span++
+	}
+
+	if update[0] != zsl.header {
+		x.backward = update[0]
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x
+	} else {
+		zsl.tail = x
+	}
+	zsl.length++
+	return x
+}
+
+// clone 按照原来的层数复制整个跳表，不需要重新比较和随机层数
+func (zsl *skiplist) clone() *skiplist {
+	n := newSkiplist()
+	n.length, n.level = zsl.length, zsl.level
+	var last [skiplistMaxLevel]*skiplistNode
+	for i := range last {
+		n.header.level[i].span = zsl.header.level[i].span
+		last[i] = n.header
+	}
+	var prev *skiplistNode
+	for x := zsl.header.level[0].forward; x != nil; x = x.level[0].forward {
+		y := &skiplistNode{member: x.member, score: x.score, backward: prev, level: make([]skiplistLevel, len(x.level))}
+		for i := range x.level {
+			y.level[i].span = x.level[i].span
+			last[i].level[i].forward = y
+			last[i] = y
+		}
+		prev = y
+	}
+	n.tail = prev
+	return n
+}
+
+// delete 删除(score, member)对应的节点
+func (zsl *skiplist) delete(score float64, member string) bool {
+	var update [skiplistMaxLevel]*skiplistNode
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && x.level[i].forward.before(score, member) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	x = x.level[0].forward
+	if x == nil || x.score != score || x.member != member {
+		return false
+	}
+
+	for i := 0; i < zsl.level; i++ {
+		if update[i].level[i].forward == x {
+			update[i].level[i].span += x.level[i].span - 1
+			update[i].level[i].forward = x.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x.backward
+	} else {
+		zsl.tail = x.backward
+	}
+	for zsl.level > 1 && zsl.header.level[zsl.level-1].forward == nil {
+		zsl.level--
+	}
+	zsl.length--
+	return true
+}
+
+// rank 返回(score, member)的排名，不存在时返回0
+func (zsl *skiplist) rank(score float64, member string) int {
+	rank := 0
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !x.level[i].forward.after(score, member) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+		if x != zsl.header && x.member == member {
+			return rank
+		}
+	}
+	return 0
+}
+
+// byRank 返回指定排名的节点
+func (zsl *skiplist) byRank(rank int) *skiplistNode {
+	traversed := 0
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span <= rank {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+		if traversed == rank {
+			return x
+		}
+	}
+	return nil
+}
+
+// first 返回score在[min, max]之间的第一个节点
+func (zsl *skiplist) first(min, max float64) *skiplistNode {
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && x.level[i].forward.score < min {
+			x = x.level[i].forward
+		}
+	}
+	x = x.level[0].forward
+	if x == nil || x.score > max {
+		return nil
+	}
+	return x
+}
+
+// last 返回score在[min, max]之间的最后一个节点
+func (zsl *skiplist) last(min, max float64) *skiplistNode {
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && x.level[i].forward.score <= max {
+			x = x.level[i].forward
+		}
+	}
+	if x == zsl.header || x.score < min {
+		return nil
+	}
+	return x
+}
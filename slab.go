@@ -0,0 +1,397 @@
+package cache
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// slab中每个entry的布局：
+// | expiration(8) | hash(8) | keyLen(2) | valueLen(4) | flags(1) | key | value |
+const (
+	slabHeaderSize = 23
+	slabMaxKeyLen  = math.MaxUint16
+	slabMaxSize    = int64(math.MaxUint32) // 偏移量用uint32保存，单个分片不能超过4GB
+
+	slabCompressed byte = 1 << 0 // value是压缩后的数据，前4个字节是压缩前的长度
+)
+
+// slabEntry entry的头部
+type slabEntry struct {
+	expiration int64
+	hash       uint64
+	keyLen     int
+	valueLen   int
+	flags      byte
+}
+
+func (e slabEntry) size() int {
+	return slabHeaderSize + e.keyLen + e.valueLen
+}
+
+// slabShard 一个分片，数据追加写入一整块预分配的字节数组，
+// 索引只有整数没有指针，gc扫描时不需要遍历里面的数据
+type slabShard struct {
+	buf   []byte
+	tail  int               // 下一个entry写入的位置
+	dead  int               // 被覆盖或者删除的entry占用的字节数，空间不够时压缩回收
+	index map[uint64]uint32 // key的哈希值 -> entry的偏移量
+}
+
+func newSlabShard(size int) *slabShard {
+	return &slabShard{
+		buf:   make([]byte, size),
+		index: make(map[uint64]uint32),
+	}
+}
+
+func (s *slabShard) header(off uint32) slabEntry {
+	b := s.buf[off:]
+	return slabEntry{
+		expiration: int64(binary.LittleEndian.Uint64(b)),
+		hash:       binary.LittleEndian.Uint64(b[8:]),
+		keyLen:     int(binary.LittleEndian.Uint16(b[16:])),
+		valueLen:   int(binary.LittleEndian.Uint32(b[18:])),
+		flags:      b[22],
+	}
+}
+
+func (s *slabShard) key(off uint32, e slabEntry) []byte {
+	start := int(off) + slabHeaderSize
+	return s.buf[start : start+e.keyLen]
+}
+
+func (s *slabShard) value(off uint32, e slabEntry) []byte {
+	start := int(off) + slabHeaderSize + e.keyLen
+	return s.buf[start : start+e.valueLen]
+}
+
+// find 查找key对应的entry，哈希相同但是key不同时返回false
+func (s *slabShard) find(h uint64, k string) (uint32, slabEntry, bool) {
+	off, ok := s.index[h]
+	if !ok {
+		return 0, slabEntry{}, false
+	}
+	e := s.header(off)
+	if string(s.key(off, e)) != k {
+		return 0, slabEntry{}, false
+	}
+	return off, e, true
+}
+
+// reserve 保证尾部有n个字节的空间，先压缩掉失效的entry，还不够时扩容
+func (s *slabShard) reserve(n int) bool {
+	if s.tail+n <= len(s.buf) {
+		return true
+	}
+	// 大小用int64计算，32位平台上int放不下4GB，分片还受到切片最大长度的限制
+	limit := slabMaxSize
+	if int64(math.MaxInt) < limit {
+		limit = math.MaxInt
+	}
+	need := int64(s.tail-s.dead) + int64(n)
+	if need > limit {
+		return false
+	}
+	size := int64(len(s.buf))
+	for size < need {
+		size *= 2
+	}
+	if size > limit {
+		size = limit
+	}
+
+	buf := make([]byte, size)
+	tail := 0
+	for h, off := range s.index {
+		e := s.header(off)
+		copy(buf[tail:], s.buf[off:int(off)+e.size()])
+		s.index[h] = uint32(tail)
+		tail += e.size()
+	}
+	s.buf, s.tail, s.dead = buf, tail, 0
+	return true
+}
+
+// set 写入一个entry，同一个哈希值已经被别的key占用时返回false
+func (s *slabShard) set(h uint64, k string, v []byte, expiration int64, flags byte) bool {
+	e := slabEntry{expiration: expiration, hash: h, keyLen: len(k), valueLen: len(v), flags: flags}
+	old, exists := s.index[h]
+	if exists {
+		oe := s.header(old)
+		if string(s.key(old, oe)) != k {
+			return false
+		}
+	}
+	if !s.reserve(e.size()) {
+		return false
+	}
+	// 压缩之后旧entry的位置可能变了
+	if exists {
+		s.dead += s.header(s.index[h]).size()
+	}
+
+	b := s.buf[s.tail:]
+	binary.LittleEndian.PutUint64(b, uint64(e.expiration))
+	binary.LittleEndian.PutUint64(b[8:], h)
+	binary.LittleEndian.PutUint16(b[16:], uint16(e.keyLen))
+	binary.LittleEndian.PutUint32(b[18:], uint32(e.valueLen))
+	b[22] = flags
+	copy(b[slabHeaderSize:], k)
+	copy(b[slabHeaderSize+e.keyLen:], v)
+
+	s.index[h] = uint32(s.tail)
+	s.tail += e.size()
+	return true
+}
+
+// remove 删除一个entry，空间留到下一次压缩时回收
+func (s *slabShard) remove(h uint64, k string) bool {
+	_, e, ok := s.find(h, k)
+	if !ok {
+		return false
+	}
+	delete(s.index, h)
+	s.dead += e.size()
+	if len(s.index) == 0 {
+		s.tail, s.dead = 0, 0
+	}
+	return true
+}
+
+// slabStore 按照key的哈希值分片的slab存储，只保存[]byte类型的value，
+// 所有操作都在cache的锁内进行
+type slabStore struct {
+	shards    []*slabShard
+	mask      uint64
+	shardSize int
+	count     int
+}
+
+func newSlabStore(shards, shardSize int) *slabStore {
+	n := 1
+	for n < shards {
+		n <<= 1
+	}
+	if shardSize < slabHeaderSize {
+		shardSize = slabHeaderSize
+	}
+	st := &slabStore{
+		shards:    make([]*slabShard, n),
+		mask:      uint64(n - 1),
+		shardSize: shardSize,
+	}
+	for i := range st.shards {
+		st.shards[i] = newSlabShard(shardSize)
+	}
+	return st
+}
+
+func (st *slabStore) shard(h uint64) *slabShard {
+	return st.shards[h&st.mask]
+}
+
+// get 返回value的副本，slab里的数据会被后续的写入覆盖或者移动
+func (st *slabStore) get(k string) ([]byte, int64, byte, bool) {
+	h := hash64(k)
+	s := st.shard(h)
+	off, e, ok := s.find(h, k)
+	if !ok {
+		return nil, 0, 0, false
+	}
+	v := make([]byte, e.valueLen)
+	copy(v, s.value(off, e))
+	return v, e.expiration, e.flags, true
+}
+
+// expiration 只读取过期时间，不复制value
+func (st *slabStore) expiration(k string) (int64, bool) {
+	h := hash64(k)
+	_, e, ok := st.shard(h).find(h, k)
+	return e.expiration, ok
+}
+
+// set 写入key，key太长、分片放不下或者哈希冲突时返回false，由调用方存到普通的map里
+func (st *slabStore) set(k string, v []byte, expiration int64, flags byte) bool {
+	if len(k) > slabMaxKeyLen || int64(len(v)) > slabMaxSize {
+		return false
+	}
+	h := hash64(k)
+	s := st.shard(h)
+	_, _, existed := s.find(h, k)
+	if !s.set(h, k, v, expiration, flags) {
+		return false
+	}
+	if !existed {
+		st.count++
+	}
+	return true
+}
+
+func (st *slabStore) remove(k string) {
+	h := hash64(k)
+	if st.shard(h).remove(h, k) {
+		st.count--
+	}
+}
+
+// each 遍历所有entry，value是slab内部数据，不能在fn之外保存，fn返回false时提前结束
+func (st *slabStore) each(fn func(k string, v []byte, expiration int64, flags byte) bool) {
+	for _, s := range st.shards {
+		for _, off := range s.index {
+			e := s.header(off)
+			if !fn(string(s.key(off, e)), s.value(off, e), e.expiration, e.flags) {
+				return
+			}
+		}
+	}
+}
+
+// reset 清空所有分片
+func (st *slabStore) reset() {
+	for i := range st.shards {
+		st.shards[i] = newSlabShard(st.shardSize)
+	}
+	st.count = 0
+}
+
+// WithSlabStorage 把[]byte类型的value保存在预分配的字节数组里，索引里没有指针，
+// 大量[]byte数据时可以明显减少gc扫描的时间。shards是分片数量，会向上取整到2的幂，
+// shardSize是每个分片初始的字节数，空间不够时先压缩再翻倍扩容。
+// 读取时返回的是数据的副本，修改它不会影响cache里的数据
+func WithSlabStorage(shards, shardSize int) Option {
+	return func(c *Cache) {
+		c.slab = newSlabStore(shards, shardSize)
+	}
+}
+
+// storedItem 获取key保存的item，压缩过的数据不会解压，包括已经过期的，外部加锁
+func (c *Cache) storedItem(k string) (Item, bool) {
+	if item, ok := c.items[k]; ok || c.slab == nil {
+		return item, ok
+	}
+	v, e, flags, ok := c.slab.get(k)
+	if !ok {
+		return Item{}, false
+	}
+	return c.slabItem(v, e, flags), true
+}
+
+// slabItem 把slab里的entry还原成保存的形式，v必须是副本
+func (c *Cache) slabItem(v []byte, e int64, flags byte) Item {
+	item := Item{itemType: c.getType(v), Object: v, Expiration: e}
+	if flags&slabCompressed != 0 {
+		item.Object = compressedValue{
+			Codec: c.compression.codec.Name(),
+			Size:  int(binary.LittleEndian.Uint32(v)),
+			Data:  v[4:],
+		}
+	}
+	return item
+}
+
+// slabValue 返回写到slab里的数据和标志位，只有[]byte和用当前Codec压缩的[]byte可以写到slab里
+func (c *Cache) slabValue(x interface{}) ([]byte, byte, bool) {
+	switch v := x.(type) {
+	case []byte:
+		return v, 0, true
+	case compressedValue:
+		if v.String || c.compression == nil || v.Codec != c.compression.codec.Name() || int64(v.Size) > slabMaxSize {
+			return nil, 0, false
+		}
+		b := make([]byte, 4+len(v.Data))
+		binary.LittleEndian.PutUint32(b, uint32(v.Size))
+		copy(b[4:], v.Data)
+		return b, slabCompressed, true
+	}
+	return nil, 0, false
+}
+
+// getItem 获取key对应的item，压缩过的数据会被解压，包括已经过期的，外部加锁。
+// 写入时压缩的数据和Load时检查过的数据都能解压，解压失败时当作不存在
+func (c *Cache) getItem(k string) (Item, bool) {
+	item, ok := c.storedItem(k)
+	if !ok {
+		return Item{}, false
+	}
+	return c.decodeItem(item)
+}
+
+// decodeItem 解压item里压缩过的数据
+func (c *Cache) decodeItem(item Item) (Item, bool) {
+	x, err := c.decompress(item.Object)
+	if err != nil {
+		return Item{}, false
+	}
+	item.Object = x
+	return item, true
+}
+
+// itemExpiration 获取key的过期时间，不复制slab里的数据，外部加锁
+func (c *Cache) itemExpiration(k string) (int64, bool) {
+	if item, ok := c.items[k]; ok || c.slab == nil {
+		return item.Expiration, ok
+	}
+	return c.slab.expiration(k)
+}
+
+// setItem 写入item，开启压缩时先按配置压缩，开启slab存储时[]byte写到slab里，
+// 其他类型写到map里，同一个key只会存在其中一个地方。写入的value可能来自外部，
+// 所以会清除own的记录，写入方复制出来的value要在写入之后再调用own，外部加写锁
+func (c *Cache) setItem(k string, item Item) {
+	delete(c.owned, k)
+	item.Object = c.compress(item.Object)
+	if c.slab != nil {
+		if v, flags, ok := c.slabValue(item.Object); ok && c.slab.set(k, v, item.Expiration, flags) {
+			delete(c.items, k)
+			return
+		}
+		c.slab.remove(k)
+	}
+	c.items[k] = item
+}
+
+// removeItem 删除key对应的item，不记录到delMap，外部加写锁
+func (c *Cache) removeItem(k string) {
+	delete(c.items, k)
+	delete(c.owned, k)
+	if c.slab != nil {
+		c.slab.remove(k)
+	}
+}
+
+// rangeStored 遍历所有保存的item，压缩过的数据不会解压，包括已经过期的，
+// fn返回false时提前结束，外部加锁
+func (c *Cache) rangeStored(fn func(k string, item Item) bool) {
+	for k, item := range c.items {
+		if !fn(k, item) {
+			return
+		}
+	}
+	if c.slab == nil {
+		return
+	}
+	c.slab.each(func(k string, v []byte, e int64, flags byte) bool {
+		b := make([]byte, len(v))
+		copy(b, v)
+		return fn(k, c.slabItem(b, e, flags))
+	})
+}
+
+// rangeItems 遍历所有item，压缩过的数据会被解压，包括已经过期的，fn返回false时提前结束，外部加锁
+func (c *Cache) rangeItems(fn func(k string, item Item) bool) {
+	c.rangeStored(func(k string, item Item) bool {
+		item, ok := c.decodeItem(item)
+		if !ok {
+			return true
+		}
+		return fn(k, item)
+	})
+}
+
+// itemCount 返回item的数量，包括已经过期的，外部加锁
+func (c *Cache) itemCount() int {
+	if c.slab == nil {
+		return len(c.items)
+	}
+	return len(c.items) + c.slab.count
+}
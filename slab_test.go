@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlabStorage(t *testing.T) {
+	// 很小的分片，写入时会反复压缩和扩容
+	c := NewClient(time.Minute, time.Minute, WithSlabStorage(4, 64))
+	defer c.StopGC()
+
+	for i := 0; i < 1000; i++ {
+		k := "k" + strconv.Itoa(i)
+		c.Set(k, []byte(k+"-v1"), DefaultExpiration)
+		c.Set(k, []byte(k+"-v2"), DefaultExpiration)
+	}
+	for i := 0; i < 1000; i += 2 {
+		c.Delete("k" + strconv.Itoa(i))
+	}
+	require.Empty(t, c.items)
+	require.Equal(t, 500, c.slab.count)
+
+	v, ok := c.Get("k1")
+	require.True(t, ok)
+	require.Equal(t, []byte("k1-v2"), v)
+	_, ok = c.Get("k2")
+	require.False(t, ok)
+	require.True(t, c.SearchDel("k2"))
+
+	// 返回的是副本
+	v.([]byte)[0] = 'x'
+	v, _ = c.Get("k1")
+	require.Equal(t, []byte("k1-v2"), v)
+
+	// 换成别的类型时从slab里移走
+	c.Set("k1", "str", DefaultExpiration)
+	v, _ = c.Get("k1")
+	require.Equal(t, "str", v)
+	require.Equal(t, 499, c.slab.count)
+
+	// 其他的读写方式也能看到slab里的数据
+	n, err := c.Append("k3", "+")
+	require.NoError(t, err)
+	require.Equal(t, len("k3-v2+"), n)
+	require.Len(t, c.Items(), 500)
+	require.Equal(t, 500, c.Snapshot().Size())
+	count := 0
+	c.Range(func(k string, v interface{}, _ time.Time) bool {
+		count++
+		return true
+	})
+	require.Equal(t, 500, count)
+
+	// 过期的数据由gc清理
+	c.Set("short", []byte("x"), time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	_, ok = c.Get("short")
+	require.False(t, ok)
+	c.delete()
+	_, ok = c.slab.expiration("short")
+	require.False(t, ok)
+	require.True(t, c.SearchDel("short"))
+
+	var buf bytes.Buffer
+	require.NoError(t, c.saveItem(&buf))
+	c2 := NewClient(time.Minute, time.Minute, WithSlabStorage(1, 1024))
+	defer c2.StopGC()
+	require.NoError(t, c2.load(&buf, 1))
+	v, _ = c2.Get("k3")
+	require.Equal(t, []byte("k3-v2+"), v)
+	require.Equal(t, 499, c2.slab.count)
+}
+
+func TestSlabCollision(t *testing.T) {
+	s := newSlabShard(64)
+	require.True(t, s.set(1, "a", []byte("x"), 0, 0))
+	require.False(t, s.set(1, "b", []byte("y"), 0, 0))
+	_, _, ok := s.find(1, "b")
+	require.False(t, ok)
+	require.False(t, s.remove(1, "b"))
+	require.True(t, s.remove(1, "a"))
+}
+
+// TestBuild32Bit 偏移量和分片大小的计算不能溢出32位平台上的int，用GOARCH=386检查整个包
+func TestBuild32Bit(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping the 32-bit build in short mode")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	cmd := exec.Command(goBin, "vet", ".")
+	cmd.Env = append(os.Environ(), "GOARCH=386", "CGO_ENABLED=0")
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, "GOARCH=386 go vet failed:\n%s", out)
+}
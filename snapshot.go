@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Snapshot cache在某个时间点的只读视图，之后的写入不会影响快照，
+// 快照只复制了key-value的映射，value本身不会深拷贝。哈希、集合、位图和列表等类型在写入时
+// 会复制一份新的value，不会影响快照，但是不要修改通过快照读到的引用类型
+type Snapshot struct {
+	at    int64           // 快照的时间点，过期判断都以这个时间为准
+	items map[string]Item // 快照时刻所有未过期的数据
+	keys  []string        // 排好序的key，提供前缀查询
+}
+
+// Snapshot 生成当前数据的快照，只在复制期间持有读锁，不会在快照的整个生命周期里阻塞写入
+func (c *Cache) Snapshot() *Snapshot {
+	c.mu.RLock()
+	c.share()
+	s := &Snapshot{
+		at:    time.Now().UnixNano(),
+		items: make(map[string]Item, c.itemCount()),
+		keys:  make([]string, 0, c.itemCount()),
+	}
+	c.rangeItems(func(k string, v Item) bool {
+		if v.Expiration == 0 || s.at <= v.Expiration {
+			s.items[k] = v
+			s.keys = append(s.keys, k)
+		}
+		return true
+	})
+	c.mu.RUnlock()
+
+	// 排序不需要持有锁，避免长时间阻塞写入
+	sort.Strings(s.keys)
+	return s
+}
+
+// CreatedAt 返回快照的时间点
+func (s *Snapshot) CreatedAt() time.Time {
+	return time.Unix(0, s.at)
+}
+
+// Get 获取快照中key对应的value
+func (s *Snapshot) Get(k string) (interface{}, bool) {
+	item, ok := s.items[k]
+	if !ok {
+		return nil, false
+	}
+	return item.Object, true
+}
+
+// GetWithExpiration 获取快照中key对应的value和过期时间，不会过期时返回零值
+func (s *Snapshot) GetWithExpiration(k string) (interface{}, time.Time, bool) {
+	item, ok := s.items[k]
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	return item.Object, item.expiresAt(), true
+}
+
+// IsExistedKey 查询快照中某个key是否存在
+func (s *Snapshot) IsExistedKey(k string) bool {
+	_, ok := s.items[k]
+	return ok
+}
+
+// IsExistedKeyWithPrefix 查询快照中是否有带有某个前缀的key
+func (s *Snapshot) IsExistedKeyWithPrefix(prefix string) bool {
+	i := sort.SearchStrings(s.keys, prefix)
+	return i < len(s.keys) && strings.HasPrefix(s.keys[i], prefix)
+}
+
+// KeysWithPrefix 按字典序返回快照中所有带有某个前缀的key
+func (s *Snapshot) KeysWithPrefix(prefix string) []string {
+	keys := make([]string, 0)
+	for i := sort.SearchStrings(s.keys, prefix); i < len(s.keys); i++ {
+		if !strings.HasPrefix(s.keys[i], prefix) {
+			break
+		}
+		keys = append(keys, s.keys[i])
+	}
+	return keys
+}
+
+// List 和Cache.List一样按层级列出快照中的key
+func (s *Snapshot) List(prefix, delimiter, marker string, maxKeys int) ListResult {
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxKeys
+	}
+
+	var res ListResult
+	count, last := 0, ""
+	start := prefix
+	if marker > start {
+		start = marker
+	}
+	for i := sort.SearchStrings(s.keys, start); i < len(s.keys); i++ {
+		k := s.keys[i]
+		if !strings.HasPrefix(k, prefix) {
+			break
+		}
+
+		entry, isPrefix := k, false
+		if delimiter != "" {
+			if j := strings.Index(k[len(prefix):], delimiter); j >= 0 {
+				entry, isPrefix = k[:len(prefix)+j+len(delimiter)], true
+			}
+		}
+		if entry <= marker || entry == last {
+			continue
+		}
+
+		if count == maxKeys {
+			res.IsTruncated = true
+			res.NextMarker = last
+			break
+		}
+		if isPrefix {
+			res.CommonPrefixes = append(res.CommonPrefixes, entry)
+		} else {
+			res.Keys = append(res.Keys, entry)
+		}
+		count++
+		last = entry
+	}
+	return res
+}
+
+// Items 复制快照中所有的items
+func (s *Snapshot) Items() map[string]Item {
+	m := make(map[string]Item, len(s.items))
+	for k, v := range s.items {
+		m[k] = v
+	}
+	return m
+}
+
+// Range 按字典序遍历快照中的数据，fn返回false时提前结束
+func (s *Snapshot) Range(fn func(k string, v interface{}, expiresAt time.Time) bool) {
+	for _, k := range s.keys {
+		item := s.items[k]
+		if !fn(k, item.Object, item.expiresAt()) {
+			return
+		}
+	}
+}
+
+// Size 返回快照中key的数量
+func (s *Snapshot) Size() int {
+	return len(s.items)
+}
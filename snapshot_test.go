@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	c.Set("report/a", 1, NoExpiration)
+	c.Set("report/b/1", 2, NoExpiration)
+	c.Set("report/b/2", 3, NoExpiration)
+	s := c.Snapshot()
+
+	// 快照之后的写入不影响快照
+	c.Set("report/a", 10, NoExpiration)
+	c.Set("report/c", 4, NoExpiration)
+	c.Delete("report/b/1")
+
+	v, ok := s.Get("report/a")
+	require.True(t, ok)
+	require.Equal(t, 1, v)
+	require.True(t, s.IsExistedKey("report/b/1"))
+	require.False(t, s.IsExistedKey("report/c"))
+	require.True(t, s.IsExistedKeyWithPrefix("report/b"))
+	require.False(t, s.IsExistedKeyWithPrefix("report/c"))
+	require.Equal(t, []string{"report/b/1", "report/b/2"}, s.KeysWithPrefix("report/b/"))
+	require.Equal(t, 3, s.Size())
+
+	res := s.List("report/", "/", "", 1)
+	require.Equal(t, []string{"report/a"}, res.Keys)
+	require.True(t, res.IsTruncated)
+	res = s.List("report/", "/", res.NextMarker, 1)
+	require.Equal(t, []string{"report/b/"}, res.CommonPrefixes)
+	require.False(t, res.IsTruncated)
+
+	v, _ = c.Get("report/a")
+	require.Equal(t, 10, v)
+}
+
+func TestSnapshotValues(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	_, err := c.HSet("hash", "a", 1)
+	require.NoError(t, err)
+	_, err = c.SAdd("set", "x")
+	require.NoError(t, err)
+	_, err = c.SetBit("bits", 0, 1)
+	require.NoError(t, err)
+	_, err = c.RPush("list", "a", "b")
+	require.NoError(t, err)
+	s := c.Snapshot()
+
+	// 快照之后修改复合类型的value，快照里的value不变
+	_, err = c.HSet("hash", "b", 2)
+	require.NoError(t, err)
+	_, err = c.HDel("hash", "a")
+	require.NoError(t, err)
+	_, err = c.SAdd("set", "y")
+	require.NoError(t, err)
+	_, err = c.SetBit("bits", 1, 1)
+	require.NoError(t, err)
+	_, err = c.SetBit("bits", 0, 0)
+	require.NoError(t, err)
+	_, err = c.RPush("list", "c")
+	require.NoError(t, err)
+	require.NoError(t, c.LTrim("list", 1, -1))
+
+	v, ok := s.Get("hash")
+	require.True(t, ok)
+	require.Equal(t, map[string]interface{}{"a": 1}, v.(Hash).Fields)
+	v, _ = s.Get("set")
+	require.Equal(t, Set{"x": true}, v)
+	v, _ = s.Get("bits")
+	require.Equal(t, []byte{0x80}, v)
+	v, _ = s.Get("list")
+	require.Equal(t, List{"a", "b"}, v)
+
+	fields, err := c.HGetAll("hash")
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"b": 2}, fields)
+	bit, err := c.GetBit("bits", 0)
+	require.NoError(t, err)
+	require.Equal(t, 0, bit)
+}
@@ -0,0 +1,438 @@
+package cache
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// StreamID 消息的ID，由毫秒时间戳和同一毫秒内的序号组成，单调递增
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+var (
+	StreamMinID = StreamID{}                                        // 最小的ID，用于表示范围的起点
+	StreamMaxID = StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64} // 最大的ID，用于表示范围的终点
+)
+
+func (id StreamID) String() string {
+	return fmt.Sprintf("%d-%d", id.Ms, id.Seq)
+}
+
+// Less 判断id是否排在o之前
+func (id StreamID) Less(o StreamID) bool {
+	return id.Ms < o.Ms || (id.Ms == o.Ms && id.Seq < o.Seq)
+}
+
+// StreamEntry 流中的一条消息
+type StreamEntry struct {
+	ID     StreamID
+	Fields map[string]interface{}
+}
+
+// PendingEntry 已经投递给消费者但是还没有确认的消息
+type PendingEntry struct {
+	ID          StreamID
+	Consumer    string    // 消息当前所属的消费者
+	DeliveredAt time.Time // 最后一次投递的时间
+	Deliveries  int       // 投递的次数
+}
+
+// ConsumerGroup 消费者组，组内的消费者共同消费一个流，每条消息只投递给其中一个消费者
+type ConsumerGroup struct {
+	LastDelivered StreamID                 // 最后投递给组内消费者的ID
+	Pending       map[string]*PendingEntry // 待确认的消息，key是ID的字符串形式
+}
+
+// Stream 只能追加的消息流类型的value
+type Stream struct {
+	Entries []StreamEntry             // 按ID排序的消息
+	LastID  StreamID                  // 最后生成的ID，裁剪之后也不会回退
+	Groups  map[string]*ConsumerGroup // 消费者组
+}
+
+func newStream() *Stream {
+	return &Stream{Groups: make(map[string]*ConsumerGroup)}
+}
+
+// clone 复制流用于修改，Get和Snapshot返回的流可能还在被读取。
+// 已有的消息不会被修改，Entries只会在末尾追加或者整体替换，所以可以和旧的流共用底层数组，
+// 旧的流只会读到自己长度以内的消息
+func (s *Stream) clone() *Stream {
+	n := &Stream{
+		Entries: s.Entries,
+		LastID:  s.LastID,
+		Groups:  make(map[string]*ConsumerGroup, len(s.Groups)),
+	}
+	for name, g := range s.Groups {
+		n.Groups[name] = g
+	}
+	return n
+}
+
+// clone 复制消费者组用于修改，待确认的消息修改时整个替换，所以只需要复制map
+func (g *ConsumerGroup) clone() *ConsumerGroup {
+	n := &ConsumerGroup{
+		LastDelivered: g.LastDelivered,
+		Pending:       make(map[string]*PendingEntry, len(g.Pending)),
+	}
+	for id, p := range g.Pending {
+		n.Pending[id] = p
+	}
+	return n
+}
+
+// nextID 生成一个比LastID大的新ID
+func (s *Stream) nextID() StreamID {
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	if ms <= s.LastID.Ms {
+		return StreamID{Ms: s.LastID.Ms, Seq: s.LastID.Seq + 1}
+	}
+	return StreamID{Ms: ms}
+}
+
+// search 返回第一个ID大于等于id的消息下标
+func (s *Stream) search(id StreamID) int {
+	return sort.Search(len(s.Entries), func(i int) bool { return !s.Entries[i].ID.Less(id) })
+}
+
+// trim 只保留最新的maxLen条消息，返回删除的数量
+func (s *Stream) trim(maxLen int) int {
+	if maxLen <= 0 || len(s.Entries) <= maxLen {
+		return 0
+	}
+	n := len(s.Entries) - maxLen
+	s.Entries = append([]StreamEntry(nil), s.Entries[n:]...)
+	return n
+}
+
+// rangeEntries 返回ID在[start, end]之间的消息，count小于等于0时不限制数量
+func (s *Stream) rangeEntries(start, end StreamID, count int, reverse bool) []StreamEntry {
+	res := make([]StreamEntry, 0)
+	from, to := s.search(start), len(s.Entries)
+	for i := from; i < len(s.Entries); i++ {
+		if end.Less(s.Entries[i].ID) {
+			to = i
+			break
+		}
+	}
+	for i := 0; i < to-from && (count <= 0 || len(res) < count); i++ {
+		j := from + i
+		if reverse {
+			j = to - 1 - i
+		}
+		res = append(res, s.Entries[j])
+	}
+	return res
+}
+
+// after 返回ID大于id的消息
+func (s *Stream) after(id StreamID, count int) []StreamEntry {
+	if id == StreamMaxID {
+		return []StreamEntry{}
+	}
+	start := StreamID{Ms: id.Ms, Seq: id.Seq + 1}
+	if id.Seq == math.MaxUint64 {
+		start = StreamID{Ms: id.Ms + 1}
+	}
+	return s.rangeEntries(start, StreamMaxID, count, false)
+}
+
+// entry 根据ID查找消息
+func (s *Stream) entry(id StreamID) (StreamEntry, bool) {
+	i := s.search(id)
+	if i < len(s.Entries) && s.Entries[i].ID == id {
+		return s.Entries[i], true
+	}
+	return StreamEntry{}, false
+}
+
+// getStream 获取key对应的流，key不存在或者已经过期时返回false，外部加锁
+func (c *Cache) getStream(k string) (*Stream, bool, error) {
+	item, ok := c.lookup(k)
+	if !ok {
+		return nil, false, nil
+	}
+	s, ok := item.Object.(*Stream)
+	if !ok {
+		return nil, false, fmt.Errorf("the value for %s is not a stream", k)
+	}
+	return s, true, nil
+}
+
+// getGroup 获取流的消费者组，外部加锁
+func (c *Cache) getGroup(k, group string) (*Stream, *ConsumerGroup, error) {
+	s, ok, err := c.getStream(k)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, nil, fmt.Errorf("item %s not found", k)
+	}
+	g, ok := s.Groups[group]
+	if !ok {
+		return nil, nil, fmt.Errorf("consumer group %s doesn't exist", group)
+	}
+	return s, g, nil
+}
+
+// mutableStream 获取key对应的流的副本用于修改，create为true时key不存在会使用默认过期时间新建，
+// 修改之后用update写回，外部加写锁
+func (c *Cache) mutableStream(k string, create bool) (*Stream, bool, error) {
+	s, ok, err := c.getStream(k)
+	if err != nil {
+		return nil, false, err
+	}
+	if !ok {
+		if !create {
+			return nil, false, nil
+		}
+		s = newStream()
+		c.add(k, s, DefaultExpiration)
+		return s, true, nil
+	}
+	return s.clone(), true, nil
+}
+
+// mutableGroup 获取流和消费者组的副本用于修改，修改之后用update写回，外部加写锁
+func (c *Cache) mutableGroup(k, group string) (*Stream, *ConsumerGroup, error) {
+	s, g, err := c.getGroup(k, group)
+	if err != nil {
+		return nil, nil, err
+	}
+	s = s.clone()
+	g = g.clone()
+	s.Groups[group] = g
+	return s, g, nil
+}
+
+// XAdd 向流中追加一条消息，返回自动生成的ID，maxLen大于0时只保留最新的maxLen条消息，
+// key不存在时使用默认过期时间新建，会唤醒阻塞在XRead和XReadGroup上的调用方，
+// fields会被复制，之后修改它不会影响流中的消息
+func (c *Cache) XAdd(k string, maxLen int, fields map[string]interface{}) (StreamID, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, _, err := c.mutableStream(k, true)
+	if err != nil {
+		return StreamID{}, err
+	}
+
+	f := make(map[string]interface{}, len(fields))
+	for name, v := range fields {
+		f[name] = v
+	}
+	id := s.nextID()
+	s.Entries = append(s.Entries, StreamEntry{ID: id, Fields: f})
+	s.LastID = id
+	s.trim(maxLen)
+	c.update(k, s)
+	c.notify(k)
+	return id, nil
+}
+
+// XTrim 只保留最新的maxLen条消息，返回删除的数量
+func (c *Cache) XTrim(k string, maxLen int) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok, err := c.mutableStream(k, false)
+	if err != nil || !ok {
+		return 0, err
+	}
+	n := s.trim(maxLen)
+	c.update(k, s)
+	return n, nil
+}
+
+// XLen 返回流中消息的数量
+func (c *Cache) XLen(k string) (int, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	s, ok, err := c.getStream(k)
+	if err != nil || !ok {
+		return 0, err
+	}
+	return len(s.Entries), nil
+}
+
+// XRange 按ID从小到大返回[start, end]之间的消息，count小于等于0时不限制数量
+func (c *Cache) XRange(k string, start, end StreamID, count int) ([]StreamEntry, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	s, ok, err := c.getStream(k)
+	if err != nil || !ok {
+		return []StreamEntry{}, err
+	}
+	return s.rangeEntries(start, end, count, false), nil
+}
+
+// XRevRange 按ID从大到小返回[start, end]之间的消息，count小于等于0时不限制数量
+func (c *Cache) XRevRange(k string, end, start StreamID, count int) ([]StreamEntry, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	s, ok, err := c.getStream(k)
+	if err != nil || !ok {
+		return []StreamEntry{}, err
+	}
+	return s.rangeEntries(start, end, count, true), nil
+}
+
+// XRead 读取ID大于after的消息，没有新消息时最多阻塞block，block小于等于0时不阻塞，
+// 超时返回空的结果
+func (c *Cache) XRead(k string, after StreamID, count int, block time.Duration) ([]StreamEntry, error) {
+	deadline := time.Now().Add(block)
+	for {
+		c.mu.Lock()
+		s, ok, err := c.getStream(k)
+		if err != nil {
+			c.mu.Unlock()
+			return nil, err
+		}
+		if ok {
+			if res := s.after(after, count); len(res) > 0 {
+				c.mu.Unlock()
+				return res, nil
+			}
+		}
+		ch := c.watch(k)
+		c.mu.Unlock()
+
+		if !c.wait(k, ch, deadline) {
+			return []StreamEntry{}, nil
+		}
+	}
+}
+
+// XGroupCreate 为流创建消费者组，组内的消费者从ID大于start的消息开始消费，
+// 传入流的最后一个ID表示只消费新消息，key不存在时使用默认过期时间新建一个空的流
+func (c *Cache) XGroupCreate(k, group string, start StreamID) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, _, err := c.mutableStream(k, true)
+	if err != nil {
+		return err
+	}
+	if _, ok := s.Groups[group]; ok {
+		return fmt.Errorf("consumer group %s already exists", group)
+	}
+	s.Groups[group] = &ConsumerGroup{
+		LastDelivered: start,
+		Pending:       make(map[string]*PendingEntry),
+	}
+	c.update(k, s)
+	return nil
+}
+
+// XReadGroup 以消费者的身份从消费者组读取还没有投递过的消息，读到的消息进入待确认列表，
+// 没有新消息时最多阻塞block，block小于等于0时不阻塞，超时返回空的结果
+func (c *Cache) XReadGroup(k, group, consumer string, count int, block time.Duration) ([]StreamEntry, error) {
+	deadline := time.Now().Add(block)
+	for {
+		c.mu.Lock()
+		s, g, err := c.getGroup(k, group)
+		if err != nil {
+			c.mu.Unlock()
+			return nil, err
+		}
+		if res := s.after(g.LastDelivered, count); len(res) > 0 {
+			s, g, _ = c.mutableGroup(k, group)
+			now := time.Now()
+			for _, e := range res {
+				g.Pending[e.ID.String()] = &PendingEntry{
+					ID:          e.ID,
+					Consumer:    consumer,
+					DeliveredAt: now,
+					Deliveries:  1,
+				}
+			}
+			g.LastDelivered = res[len(res)-1].ID
+			c.update(k, s)
+			c.mu.Unlock()
+			return res, nil
+		}
+		ch := c.watch(k)
+		c.mu.Unlock()
+
+		if !c.wait(k, ch, deadline) {
+			return []StreamEntry{}, nil
+		}
+	}
+}
+
+// XAck 确认消息已经处理完成，从待确认列表中删除，返回确认的数量
+func (c *Cache) XAck(k, group string, ids ...StreamID) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, g, err := c.mutableGroup(k, group)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, id := range ids {
+		if _, ok := g.Pending[id.String()]; ok {
+			delete(g.Pending, id.String())
+			n++
+		}
+	}
+	c.update(k, s)
+	return n, nil
+}
+
+// XPending 按ID排序返回消费者组中所有待确认的消息
+func (c *Cache) XPending(k, group string) ([]PendingEntry, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	_, g, err := c.getGroup(k, group)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]PendingEntry, 0, len(g.Pending))
+	for _, p := range g.Pending {
+		res = append(res, *p)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID.Less(res[j].ID) })
+	return res, nil
+}
+
+// XClaim 把空闲时间超过minIdle的待确认消息转给consumer，返回转移成功的消息，
+// 已经被裁剪掉的消息会直接从待确认列表中删除
+func (c *Cache) XClaim(k, group, consumer string, minIdle time.Duration, ids ...StreamID) ([]StreamEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, g, err := c.mutableGroup(k, group)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	res := make([]StreamEntry, 0, len(ids))
+	for _, id := range ids {
+		p, ok := g.Pending[id.String()]
+		if !ok || now.Sub(p.DeliveredAt) < minIdle {
+			continue
+		}
+		e, ok := s.entry(id)
+		if !ok {
+			delete(g.Pending, id.String())
+			continue
+		}
+		claimed := *p
+		claimed.Consumer = consumer
+		claimed.DeliveredAt = now
+		claimed.Deliveries++
+		g.Pending[id.String()] = &claimed
+		res = append(res, e)
+	}
+	c.update(k, s)
+	return res, nil
+}
@@ -0,0 +1,137 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStream(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	ids := make([]StreamID, 0)
+	for i := 0; i < 5; i++ {
+		id, err := c.XAdd("s", 3, map[string]interface{}{"n": i})
+		require.NoError(t, err)
+		if len(ids) > 0 {
+			require.True(t, ids[len(ids)-1].Less(id))
+		}
+		ids = append(ids, id)
+	}
+	n, _ := c.XLen("s")
+	require.Equal(t, 3, n)
+
+	res, _ := c.XRange("s", StreamMinID, StreamMaxID, 2)
+	require.Equal(t, []StreamID{ids[2], ids[3]}, []StreamID{res[0].ID, res[1].ID})
+	res, _ = c.XRevRange("s", StreamMaxID, ids[3], 0)
+	require.Equal(t, []StreamID{ids[4], ids[3]}, []StreamID{res[0].ID, res[1].ID})
+
+	// 阻塞读取，被新消息唤醒
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		c.XAdd("s", 0, map[string]interface{}{"n": 5})
+	}()
+	res, err := c.XRead("s", ids[4], 0, time.Second)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	require.Equal(t, 5, res[0].Fields["n"])
+
+	// 超时
+	res, _ = c.XRead("s", res[0].ID, 0, 10*time.Millisecond)
+	require.Empty(t, res)
+	// 超时之后不再等待的通道被删除
+	c.mu.RLock()
+	require.Empty(t, c.watchers)
+	c.mu.RUnlock()
+
+	var buf bytes.Buffer
+	require.NoError(t, c.saveItem(&buf))
+	c2 := NewClient(time.Minute, time.Minute)
+	defer c2.StopGC()
+	require.NoError(t, c2.load(&buf, 1))
+	n, _ = c2.XLen("s")
+	require.Equal(t, 4, n)
+}
+
+func TestStreamGroup(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	require.NoError(t, c.XGroupCreate("s", "g", StreamMinID))
+	require.Error(t, c.XGroupCreate("s", "g", StreamMinID))
+	for i := 0; i < 3; i++ {
+		c.XAdd("s", 0, map[string]interface{}{"n": i})
+	}
+
+	res, err := c.XReadGroup("s", "g", "alice", 2, 0)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	res2, _ := c.XReadGroup("s", "g", "bob", 0, 0)
+	require.Len(t, res2, 1)
+	res3, _ := c.XReadGroup("s", "g", "bob", 0, 0)
+	require.Empty(t, res3)
+
+	n, _ := c.XAck("s", "g", res[0].ID)
+	require.Equal(t, 1, n)
+	pending, _ := c.XPending("s", "g")
+	require.Len(t, pending, 2)
+	require.Equal(t, "alice", pending[0].Consumer)
+
+	claimed, _ := c.XClaim("s", "g", "bob", time.Hour, res[1].ID)
+	require.Empty(t, claimed)
+	claimed, _ = c.XClaim("s", "g", "bob", 0, res[1].ID)
+	require.Len(t, claimed, 1)
+	pending, _ = c.XPending("s", "g")
+	require.Equal(t, "bob", pending[0].Consumer)
+	require.Equal(t, 2, pending[0].Deliveries)
+
+	var buf bytes.Buffer
+	require.NoError(t, c.saveItem(&buf))
+	c2 := NewClient(time.Minute, time.Minute)
+	defer c2.StopGC()
+	require.NoError(t, c2.load(&buf, 1))
+	pending, _ = c2.XPending("s", "g")
+	require.Len(t, pending, 2)
+}
+
+func TestStreamCopyOnWrite(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	fields := map[string]interface{}{"n": 0}
+	id, err := c.XAdd("s", 0, fields)
+	require.NoError(t, err)
+	fields["n"] = 100
+	require.NoError(t, c.XGroupCreate("s", "g", StreamMinID))
+	_, err = c.XReadGroup("s", "g", "alice", 0, 0)
+	require.NoError(t, err)
+
+	v, _ := c.Get("s")
+	held := v.(*Stream)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i < 50; i++ {
+			_, _ = c.XAdd("s", 0, map[string]interface{}{"n": i})
+			_, _ = c.XReadGroup("s", "g", "alice", 1, 0)
+			_, _ = c.XClaim("s", "g", "bob", 0, id)
+			_, _ = c.XAck("s", "g", id)
+		}
+		_, _ = c.XTrim("s", 1)
+	}()
+	for i := 0; i < 50; i++ {
+		_ = len(held.Entries)
+		_ = held.Groups["g"].Pending[id.String()].Consumer
+	}
+	<-done
+
+	require.Len(t, held.Entries, 1)
+	require.Equal(t, 0, held.Entries[0].Fields["n"])
+	require.Equal(t, "alice", held.Groups["g"].Pending[id.String()].Consumer)
+	require.Len(t, held.Groups["g"].Pending, 1)
+	n, _ := c.XLen("s")
+	require.Equal(t, 1, n)
+}
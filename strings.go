@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"fmt"
+	"strings"
+)
+
+// getText 获取key对应的string或者[]byte，raw表示原来的value是不是[]byte，
+// key不存在或者已经过期时返回false，外部加锁
+func (c *Cache) getText(k string) (s string, raw bool, ok bool, err error) {
+	item, ok := c.lookup(k)
+	if !ok {
+		return "", false, false, nil
+	}
+	switch v := item.Object.(type) {
+	case string:
+		return v, false, true, nil
+	case []byte:
+		return string(v), true, true, nil
+	}
+	return "", false, false, fmt.Errorf("the value for %s is not a string or byte slice", k)
+}
+
+// putText 按原来的类型写回修改后的内容，保留原来的过期时间，
+// key不存在时使用默认过期时间新建一个string，外部加写锁
+func (c *Cache) putText(k string, s string, raw, ok bool) {
+	var x interface{} = s
+	if raw {
+		x = []byte(s)
+	}
+	if !ok {
+		c.add(k, x, DefaultExpiration)
+		return
+	}
+	c.update(k, x)
+}
+
+// Append 把value追加到string或者[]byte的末尾，返回追加后的长度，
+// key不存在时使用默认过期时间新建一个string
+func (c *Cache) Append(k string, value string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// []byte直接在原来的切片上追加，容量不够时由append按倍数扩容，避免每次追加都复制全部内容。
+	// 交出去之后第一次追加时截断容量，让append复制一份，不会写到外部持有的底层数组里
+	if b, ok, _ := c.getBytes(k); ok {
+		if value == "" {
+			return len(b), nil
+		}
+		if !c.owns(k) {
+			b = b[:len(b):len(b)]
+		}
+		b = append(b, value...)
+		c.update(k, b)
+		c.own(k)
+		return len(b), nil
+	}
+
+	s, raw, ok, err := c.getText(k)
+	if err != nil {
+		return 0, err
+	}
+	s += value
+	c.putText(k, s, raw, ok)
+	return len(s), nil
+}
+
+// GetRange 返回[start, end]区间的内容，下标按字节计算，为负数时从尾部开始计算，
+// key不存在时返回空字符串
+func (c *Cache) GetRange(k string, start, end int) (string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	s, _, _, err := c.getText(k)
+	if err != nil {
+		return "", err
+	}
+	from, to, ok := listRange(start, end, len(s))
+	if !ok {
+		return "", nil
+	}
+	return s[from:to], nil
+}
+
+// SetRange 从offset开始用value覆盖原来的内容，长度不够时用零字节补齐，返回修改后的长度，
+// key不存在时使用默认过期时间新建一个string，value为空时不会新建key
+func (c *Cache) SetRange(k string, offset int, value string) (int, error) {
+	if offset < 0 || int64(offset+len(value)) > maxBitOffset>>3 {
+		return 0, fmt.Errorf("offset is out of range")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, raw, ok, err := c.getText(k)
+	if err != nil {
+		return 0, err
+	}
+	if len(value) == 0 {
+		return len(s), nil
+	}
+
+	if offset > len(s) {
+		s += strings.Repeat("\x00", offset-len(s))
+	}
+	if end := offset + len(value); end < len(s) {
+		s = s[:offset] + value + s[end:]
+	} else {
+		s = s[:offset] + value
+	}
+	c.putText(k, s, raw, ok)
+	return len(s), nil
+}
+
+// StrLen 返回string或者[]byte的字节长度，key不存在时返回0
+func (c *Cache) StrLen(k string) (int, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	s, _, _, err := c.getText(k)
+	return len(s), err
+}
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStringOps(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	n, err := c.Append("log", "hello")
+	require.NoError(t, err)
+	require.Equal(t, 5, n)
+	n, err = c.Append("log", " world")
+	require.NoError(t, err)
+	require.Equal(t, 11, n)
+
+	s, err := c.GetRange("log", 0, 4)
+	require.NoError(t, err)
+	require.Equal(t, "hello", s)
+	s, err = c.GetRange("log", -5, -1)
+	require.NoError(t, err)
+	require.Equal(t, "world", s)
+	s, err = c.GetRange("log", 20, 30)
+	require.NoError(t, err)
+	require.Equal(t, "", s)
+
+	n, err = c.SetRange("log", 6, "redis")
+	require.NoError(t, err)
+	require.Equal(t, 11, n)
+	v, _ := c.Get("log")
+	require.Equal(t, "hello redis", v)
+
+	// 超出长度时补零
+	n, err = c.SetRange("pad", 3, "ab")
+	require.NoError(t, err)
+	require.Equal(t, 5, n)
+	v, _ = c.Get("pad")
+	require.Equal(t, "\x00\x00\x00ab", v)
+	_, err = c.SetRange("pad", -1, "x")
+	require.Error(t, err)
+
+	// []byte保持原来的类型和过期时间
+	// Cache.GetWithExpiration还不返回过期时间，通过快照读取
+	c.Set("buf", []byte("ab"), time.Hour)
+	_, before, _ := c.Snapshot().GetWithExpiration("buf")
+	require.False(t, before.IsZero())
+	_, err = c.Append("buf", "cd")
+	require.NoError(t, err)
+	v, exp, _ := c.Snapshot().GetWithExpiration("buf")
+	require.Equal(t, []byte("abcd"), v)
+	require.Equal(t, before, exp)
+
+	n, err = c.StrLen("buf")
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+	n, err = c.StrLen("missing")
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	c.Set("num", 1, DefaultExpiration)
+	_, err = c.Append("num", "x")
+	require.Error(t, err)
+	_, err = c.StrLen("num")
+	require.Error(t, err)
+}
+
+func TestAppendBytes(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	c.Set("buf", []byte("ab"), DefaultExpiration)
+	v, _ := c.Get("buf")
+	_, err := c.Append("buf", "cd")
+	require.NoError(t, err)
+	// 交出去的切片不受之后的追加影响
+	require.Equal(t, []byte("ab"), v)
+
+	// 没有交出去时容量够就原地追加，不复制
+	c.mu.RLock()
+	first := c.items["buf"].Object.([]byte)
+	c.mu.RUnlock()
+	for cap(first) == len(first) {
+		_, err = c.Append("buf", "x")
+		require.NoError(t, err)
+		c.mu.RLock()
+		first = c.items["buf"].Object.([]byte)
+		c.mu.RUnlock()
+	}
+	n, err := c.Append("buf", "y")
+	require.NoError(t, err)
+	c.mu.RLock()
+	b := c.items["buf"].Object.([]byte)
+	c.mu.RUnlock()
+	require.Equal(t, len(first)+1, n)
+	require.Same(t, &first[0], &b[0])
+
+	s := c.Snapshot()
+	_, err = c.Append("buf", "z")
+	require.NoError(t, err)
+	v, _ = s.Get("buf")
+	require.Equal(t, b, v)
+	v, _ = c.Get("buf")
+	require.Equal(t, append(append([]byte(nil), b...), 'z'), v)
+
+	n, err = c.Append("buf", "")
+	require.NoError(t, err)
+	require.Equal(t, len(b)+1, n)
+}
@@ -1,7 +1,15 @@
 package cache
 
+import (
+	"sort"
+	"sync/atomic"
+)
+
 type trie struct {
-	children [60]*trie
+	hits     int64   // key被Get的次数，读锁下也会更新，必须原子操作
+	score    float64 // 用户指定的排序分数
+	scored   bool    // 是否指定过排序分数
+	children map[rune]*trie
 	isEnd    bool
 }
 
@@ -9,22 +17,31 @@ func newTrie() *trie {
 	return &trie{}
 }
 
-func (t *trie) insert(key string) {
+// insert 加入key并返回key对应的节点
+func (t *trie) insert(key string) *trie {
 	node := t
 	for _, ch := range key {
-		ch -= 'A'
+		if node.children == nil {
+			node.children = make(map[rune]*trie)
+		}
 		if node.children[ch] == nil {
 			node.children[ch] = &trie{}
 		}
 		node = node.children[ch]
 	}
 	node.isEnd = true
+	return node
+}
+
+// resetRank 清除节点的访问次数和排序分数，外部加写锁
+func (t *trie) resetRank() {
+	atomic.StoreInt64(&t.hits, 0)
+	t.score, t.scored = 0, false
 }
 
 func (t *trie) searchPrefix(prefix string) *trie {
 	node := t
 	for _, ch := range prefix {
-		ch -= 'A'
 		if node.children[ch] == nil {
 			return nil
 		}
@@ -36,3 +53,41 @@ func (t *trie) searchPrefix(prefix string) *trie {
 func (t *trie) startsWithPrefix(prefix string) bool {
 	return t.searchPrefix(prefix) != nil
 }
+
+// sortedChildren 按字典序返回子节点的字符，保证遍历结果有序
+func (t *trie) sortedChildren() []rune {
+	chs := make([]rune, 0, len(t.children))
+	for ch := range t.children {
+		chs = append(chs, ch)
+	}
+	sort.Slice(chs, func(i, j int) bool { return chs[i] < chs[j] })
+	return chs
+}
+
+// hit 记录一次key的访问，只在读锁下调用，不修改树结构
+func (t *trie) hit(key string) {
+	if node := t.searchPrefix(key); node != nil && node.isEnd {
+		atomic.AddInt64(&node.hits, 1)
+	}
+}
+
+// rank 返回节点的排序分数，指定过分数的使用指定分数，否则使用访问次数
+func (t *trie) rank() float64 {
+	if t.scored {
+		return t.score
+	}
+	return float64(atomic.LoadInt64(&t.hits))
+}
+
+// walk 遍历子树中所有的key，fn返回false时停止遍历
+func (t *trie) walk(path string, fn func(key string) bool) bool {
+	if t.isEnd && !fn(path) {
+		return false
+	}
+	for ch, child := range t.children {
+		if !child.walk(path+string(ch), fn) {
+			return false
+		}
+	}
+	return true
+}
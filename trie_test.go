@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestList(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	c.Set("tenant/a/1", 1, NoExpiration)
+	c.Set("tenant/a/2", 2, NoExpiration)
+	c.Set("tenant/b/1", 3, NoExpiration)
+	c.Set("tenant/c", 4, NoExpiration)
+	c.Set("tenant/d/1", 5, NoExpiration)
+	c.Delete("tenant/d/1")
+
+	res := c.List("tenant/", "/", "", 0)
+	require.Equal(t, []string{"tenant/c"}, res.Keys)
+	require.Equal(t, []string{"tenant/a/", "tenant/b/"}, res.CommonPrefixes)
+	require.False(t, res.IsTruncated)
+
+	// 分页
+	res = c.List("tenant/", "/", "", 2)
+	require.Equal(t, []string{"tenant/a/", "tenant/b/"}, res.CommonPrefixes)
+	require.True(t, res.IsTruncated)
+	res = c.List("tenant/", "/", res.NextMarker, 2)
+	require.Equal(t, []string{"tenant/c"}, res.Keys)
+	require.Empty(t, res.CommonPrefixes)
+	require.False(t, res.IsTruncated)
+
+	// 不折叠
+	res = c.List("tenant/a", "", "", 0)
+	require.Equal(t, []string{"tenant/a/1", "tenant/a/2"}, res.Keys)
+}
+
+func TestSuggest(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	c.Set("apple", 1, NoExpiration)
+	c.Set("apply", 2, NoExpiration)
+	c.Set("apricot", 3, NoExpiration)
+	c.Set("banana", 4, NoExpiration)
+	c.Set("april", 5, time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		c.Get("apply")
+	}
+	c.Get("apricot")
+	time.Sleep(2 * time.Millisecond)
+
+	require.Equal(t, []string{"apply", "apricot"}, c.Suggest("ap", 2))
+	require.Equal(t, []string{"apply", "apricot", "apple"}, c.Suggest("ap", 10))
+
+	require.NoError(t, c.SetScore("apple", 100))
+	require.Equal(t, []string{"apple"}, c.Suggest("ap", 1))
+	require.Error(t, c.SetScore("april", 1))
+	require.Empty(t, c.Suggest("x", 3))
+
+	// 覆盖未过期的key时保留排名，删除或者过期之后重新写入的key从零开始
+	c.Set("apply", 6, NoExpiration)
+	require.Equal(t, []string{"apple", "apply", "apricot"}, c.Suggest("ap", 10))
+	c.Delete("apple")
+	c.Set("apple", 1, NoExpiration)
+	require.Equal(t, []string{"apply", "apricot", "apple"}, c.Suggest("ap", 10))
+	c.Delete("apply")
+	_, err := c.HSet("apply", "f", 1)
+	require.NoError(t, err)
+	require.Equal(t, []string{"apricot", "apple", "apply"}, c.Suggest("ap", 10))
+	c.Set("april", 5, NoExpiration)
+	require.Equal(t, []string{"apricot", "apple", "apply", "april"}, c.Suggest("ap", 10))
+}
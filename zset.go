@@ -0,0 +1,353 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"math"
+)
+
+// Z 有序集合中的一个成员和它的分数
+type Z struct {
+	Member string
+	Score  float64
+}
+
+// SortedSet 有序集合类型的value，使用跳表按分数排序，分数相同时按member的字典序排序
+type SortedSet struct {
+	dict map[string]float64 // member -> score
+	zsl  *skiplist
+}
+
+func newSortedSet() *SortedSet {
+	return &SortedSet{
+		dict: make(map[string]float64),
+		zsl:  newSkiplist(),
+	}
+}
+
+// GobEncode 只持久化member和score，跳表在GobDecode时重建
+func (z *SortedSet) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(z.dict); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode 根据持久化的member和score重建跳表
+func (z *SortedSet) GobDecode(data []byte) error {
+	dict := make(map[string]float64)
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&dict); err != nil {
+		return err
+	}
+	*z = *newSortedSet()
+	for m, score := range dict {
+		z.add(m, score)
+	}
+	return nil
+}
+
+// clone 复制有序集合，修改交出去过的有序集合之前必须复制
+func (z *SortedSet) clone() *SortedSet {
+	n := &SortedSet{dict: make(map[string]float64, len(z.dict)), zsl: z.zsl.clone()}
+	for m, score := range z.dict {
+		n.dict[m] = score
+	}
+	return n
+}
+
+// add 加入或者更新一个成员，新加入时返回true
+func (z *SortedSet) add(member string, score float64) bool {
+	old, ok := z.dict[member]
+	if ok {
+		if old != score {
+			z.zsl.delete(old, member)
+			z.zsl.insert(score, member)
+			z.dict[member] = score
+		}
+		return false
+	}
+	z.zsl.insert(score, member)
+	z.dict[member] = score
+	return true
+}
+
+// remove 删除一个成员
+func (z *SortedSet) remove(member string) bool {
+	score, ok := z.dict[member]
+	if !ok {
+		return false
+	}
+	z.zsl.delete(score, member)
+	delete(z.dict, member)
+	return true
+}
+
+// card 返回成员的数量
+func (z *SortedSet) card() int {
+	return z.zsl.length
+}
+
+// rangeByRank 返回排名在[start, stop]之间的成员，下标从0开始，可以为负数
+func (z *SortedSet) rangeByRank(start, stop int, reverse bool) []Z {
+	from, to, ok := listRange(start, stop, z.card())
+	if !ok {
+		return []Z{}
+	}
+
+	res := make([]Z, 0, to-from)
+	var x *skiplistNode
+	if reverse {
+		x = z.zsl.byRank(z.card() - from)
+	} else {
+		x = z.zsl.byRank(from + 1)
+	}
+	for i := from; i < to && x != nil; i++ {
+		res = append(res, Z{Member: x.member, Score: x.score})
+		if reverse {
+			x = x.backward
+		} else {
+			x = x.level[0].forward
+		}
+	}
+	return res
+}
+
+// rangeByScore 返回分数在[min, max]之间的成员，跳过前offset个，count小于0时不限制数量
+func (z *SortedSet) rangeByScore(min, max float64, offset, count int, reverse bool) []Z {
+	res := make([]Z, 0)
+	var x *skiplistNode
+	if reverse {
+		x = z.zsl.last(min, max)
+	} else {
+		x = z.zsl.first(min, max)
+	}
+	for ; x != nil && count != 0; offset-- {
+		if x.score < min || x.score > max {
+			break
+		}
+		if offset <= 0 {
+			res = append(res, Z{Member: x.member, Score: x.score})
+			count--
+		}
+		if reverse {
+			x = x.backward
+		} else {
+			x = x.level[0].forward
+		}
+	}
+	return res
+}
+
+// getZSet 获取key对应的有序集合，key不存在或者已经过期时返回false，外部加锁
+func (c *Cache) getZSet(k string) (*SortedSet, bool, error) {
+	item, ok := c.lookup(k)
+	if !ok {
+		return nil, false, nil
+	}
+	z, ok := item.Object.(*SortedSet)
+	if !ok {
+		return nil, false, fmt.Errorf("the value for %s is not a sorted set", k)
+	}
+	return z, true, nil
+}
+
+// putZSet 修改完成之后写回有序集合，existed为false时使用默认过期时间新建，
+// 有序集合为空时删除这个key，外部加写锁
+func (c *Cache) putZSet(k string, z *SortedSet, existed bool) {
+	switch {
+	case z.card() == 0:
+		if existed {
+			c.manualDelete(k)
+		}
+		return
+	case existed:
+		c.update(k, z)
+	default:
+		c.add(k, z, DefaultExpiration)
+	}
+	c.own(k)
+}
+
+// mutableZSet 获取key对应的有序集合用于修改，修改之后用putZSet写回，外部加写锁。
+// 跳表复制的代价比较高，Get和Snapshot交出去之后第一次修改时才复制一份，
+// key不存在时create为true返回一个新的有序集合，existed为false
+func (c *Cache) mutableZSet(k string, create bool) (*SortedSet, bool, error) {
+	z, ok, err := c.getZSet(k)
+	switch {
+	case err != nil:
+		return nil, false, err
+	case !ok && create:
+		return newSortedSet(), false, nil
+	case !ok:
+		return nil, false, nil
+	case !c.owns(k):
+		z = z.clone()
+	}
+	return z, true, nil
+}
+
+// ZAdd 向有序集合中加入成员或者更新成员的分数，返回新加入的数量，
+// key不存在时使用默认过期时间新建一个有序集合
+func (c *Cache) ZAdd(k string, members ...Z) (int, error) {
+	for _, m := range members {
+		if math.IsNaN(m.Score) {
+			return 0, fmt.Errorf("the score of %s is not a number", m.Member)
+		}
+	}
+
+	if len(members) == 0 {
+		return 0, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	z, existed, err := c.mutableZSet(k, true)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, m := range members {
+		if z.add(m.Member, m.Score) {
+			n++
+		}
+	}
+	c.putZSet(k, z, existed)
+	return n, nil
+}
+
+// ZRem 删除有序集合中的成员，返回删除的数量，有序集合为空时删除这个key
+func (c *Cache) ZRem(k string, members ...string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	z, ok, err := c.mutableZSet(k, false)
+	if err != nil || !ok {
+		return 0, err
+	}
+	n := 0
+	for _, m := range members {
+		if z.remove(m) {
+			n++
+		}
+	}
+	c.putZSet(k, z, true)
+	return n, nil
+}
+
+// ZScore 返回成员的分数，成员不存在时返回false
+func (c *Cache) ZScore(k, member string) (float64, bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	z, ok, err := c.getZSet(k)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	score, ok := z.dict[member]
+	return score, ok, nil
+}
+
+// ZIncrBy 为成员的分数增加incr，成员不存在时从0开始，返回新的分数
+func (c *Cache) ZIncrBy(k string, incr float64, member string) (float64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	z, existed, err := c.mutableZSet(k, true)
+	if err != nil {
+		return 0, err
+	}
+	score := z.dict[member] + incr
+	if math.IsNaN(score) {
+		return 0, fmt.Errorf("the score of %s is not a number", member)
+	}
+	z.add(member, score)
+	c.putZSet(k, z, existed)
+	return score, nil
+}
+
+// ZRank 返回成员从0开始的排名，reverse为true时按分数从高到低排名，成员不存在时返回false
+func (c *Cache) ZRank(k, member string, reverse bool) (int, bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	z, ok, err := c.getZSet(k)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	score, ok := z.dict[member]
+	if !ok {
+		return 0, false, nil
+	}
+	rank := z.zsl.rank(score, member) - 1
+	if reverse {
+		rank = z.card() - 1 - rank
+	}
+	return rank, true, nil
+}
+
+// ZRange 返回排名在[start, stop]之间的成员，下标为负数时从最后一名开始计算，
+// reverse为true时按分数从高到低排序
+func (c *Cache) ZRange(k string, start, stop int, reverse bool) ([]Z, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	z, ok, err := c.getZSet(k)
+	if err != nil || !ok {
+		return []Z{}, err
+	}
+	return z.rangeByRank(start, stop, reverse), nil
+}
+
+// ZRangeByScore 返回分数在[min, max]之间的成员，可以用math.Inf表示没有边界，
+// 跳过前offset个之后最多返回count个，count小于0时不限制数量，reverse为true时按分数从高到低排序
+func (c *Cache) ZRangeByScore(k string, min, max float64, offset, count int, reverse bool) ([]Z, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	z, ok, err := c.getZSet(k)
+	if err != nil || !ok {
+		return []Z{}, err
+	}
+	return z.rangeByScore(min, max, offset, count, reverse), nil
+}
+
+// ZPopMin 取出并删除分数最低的count个成员
+func (c *Cache) ZPopMin(k string, count int) ([]Z, error) {
+	return c.zpop(k, count, false)
+}
+
+// ZPopMax 取出并删除分数最高的count个成员
+func (c *Cache) ZPopMax(k string, count int) ([]Z, error) {
+	return c.zpop(k, count, true)
+}
+
+func (c *Cache) zpop(k string, count int, max bool) ([]Z, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	z, ok, err := c.mutableZSet(k, false)
+	if err != nil || !ok || count <= 0 {
+		return []Z{}, err
+	}
+	res := z.rangeByRank(0, count-1, max)
+	for _, m := range res {
+		z.remove(m.Member)
+	}
+	c.putZSet(k, z, true)
+	return res, nil
+}
+
+// ZCard 返回有序集合的成员数量，key不存在时返回0
+func (c *Cache) ZCard(k string) (int, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	z, ok, err := c.getZSet(k)
+	if err != nil || !ok {
+		return 0, err
+	}
+	return z.card(), nil
+}
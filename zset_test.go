@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSkiplist(t *testing.T) {
+	z := newSortedSet()
+	expected := make(map[string]float64)
+	for i := 0; i < 2000; i++ {
+		m := fmt.Sprintf("m%d", rand.Intn(500))
+		if rand.Intn(4) == 0 {
+			z.remove(m)
+			delete(expected, m)
+			continue
+		}
+		score := float64(rand.Intn(100))
+		z.add(m, score)
+		expected[m] = score
+	}
+
+	sorted := make([]Z, 0, len(expected))
+	for m, score := range expected {
+		sorted = append(sorted, Z{m, score})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Score != sorted[j].Score {
+			return sorted[i].Score < sorted[j].Score
+		}
+		return sorted[i].Member < sorted[j].Member
+	})
+
+	require.Equal(t, len(sorted), z.card())
+	require.Equal(t, sorted, z.rangeByRank(0, -1, false))
+	for i, m := range sorted {
+		require.Equal(t, i+1, z.zsl.rank(m.Score, m.Member))
+	}
+
+	// 复制出来的跳表和原来的一样，修改副本不影响原来的跳表
+	cp := z.clone()
+	reversed := z.rangeByRank(0, -1, true)
+	require.Equal(t, sorted, cp.rangeByRank(0, -1, false))
+	require.Equal(t, reversed, cp.rangeByRank(0, -1, true))
+	for i, m := range sorted {
+		require.Equal(t, i+1, cp.zsl.rank(m.Score, m.Member))
+		require.Equal(t, m.Member, cp.zsl.byRank(i+1).member)
+	}
+	for i := 0; i < 500; i++ {
+		cp.add(fmt.Sprintf("n%d", i), float64(rand.Intn(100)))
+	}
+	cp.remove(sorted[0].Member)
+	require.Equal(t, sorted, z.rangeByRank(0, -1, false))
+	require.Equal(t, reversed, z.rangeByRank(0, -1, true))
+	require.Equal(t, len(sorted)+499, cp.card())
+}
+
+func TestSortedSet(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	n, err := c.ZAdd("board", Z{"a", 10}, Z{"b", 20}, Z{"c", 30}, Z{"d", 20})
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+
+	score, err := c.ZIncrBy("board", 15, "a")
+	require.NoError(t, err)
+	require.Equal(t, float64(25), score)
+
+	rank, ok, _ := c.ZRank("board", "a", false)
+	require.True(t, ok)
+	require.Equal(t, 2, rank)
+	rank, _, _ = c.ZRank("board", "a", true)
+	require.Equal(t, 1, rank)
+
+	res, _ := c.ZRange("board", 0, 1, true)
+	require.Equal(t, []Z{{"c", 30}, {"a", 25}}, res)
+	res, _ = c.ZRangeByScore("board", 20, math.Inf(1), 1, 2, false)
+	require.Equal(t, []Z{{"d", 20}, {"a", 25}}, res)
+	res, _ = c.ZRangeByScore("board", math.Inf(-1), 25, 0, -1, true)
+	require.Equal(t, []Z{{"a", 25}, {"d", 20}, {"b", 20}}, res)
+
+	// 持久化之后跳表重建
+	var buf bytes.Buffer
+	require.NoError(t, c.saveItem(&buf))
+	c2 := NewClient(time.Minute, time.Minute)
+	defer c2.StopGC()
+	require.NoError(t, c2.load(&buf, 1))
+	res, _ = c2.ZRange("board", 0, -1, false)
+	require.Equal(t, []Z{{"b", 20}, {"d", 20}, {"a", 25}, {"c", 30}}, res)
+
+	res, _ = c.ZPopMin("board", 1)
+	require.Equal(t, []Z{{"b", 20}}, res)
+	res, _ = c.ZPopMax("board", 5)
+	require.Equal(t, []Z{{"c", 30}, {"a", 25}, {"d", 20}}, res)
+	require.False(t, c.IsExistedKey("board"))
+}
+
+func TestSortedSetCopyOnWrite(t *testing.T) {
+	c := NewClient(time.Minute, time.Minute)
+	defer c.StopGC()
+
+	// 没有成员时不会新建key，也不会留下删除记录
+	n, err := c.ZAdd("empty")
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+	_, err = c.ZIncrBy("empty", math.NaN(), "a")
+	require.Error(t, err)
+	require.False(t, c.IsExistedKey("empty"))
+	require.False(t, c.SearchDel("empty"))
+
+	_, err = c.ZAdd("z", Z{"a", 1}, Z{"b", 2})
+	require.NoError(t, err)
+	s := c.Snapshot()
+	_, err = c.ZAdd("z", Z{"c", 3})
+	require.NoError(t, err)
+	_, err = c.ZIncrBy("z", 10, "a")
+	require.NoError(t, err)
+	_, err = c.ZRem("z", "b")
+	require.NoError(t, err)
+
+	// 快照里的有序集合不受之后的写入影响
+	v, _ := s.Get("z")
+	require.Equal(t, []Z{{"a", 1}, {"b", 2}}, v.(*SortedSet).rangeByRank(0, -1, false))
+	res, _ := c.ZRange("z", 0, -1, false)
+	require.Equal(t, []Z{{"c", 3}, {"a", 11}}, res)
+
+	// 没有交出去的有序集合原地修改
+	first := c.items["z"].Object
+	_, err = c.ZAdd("z", Z{"d", 4})
+	require.NoError(t, err)
+	_, err = c.ZPopMin("z", 1)
+	require.NoError(t, err)
+	require.Same(t, first, c.items["z"].Object)
+	v, _ = c.Get("z")
+	_, err = c.ZPopMax("z", 1)
+	require.NoError(t, err)
+	require.Equal(t, 2, v.(*SortedSet).card())
+}